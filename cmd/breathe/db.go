@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the history database",
+}
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report the history database's schema version and integrity",
+	Long: `Report the history database's schema version and integrity.
+
+Opening the database upgrades it to the latest schema first. The command
+fails if SQLite's integrity check finds problems.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.DataPath()
+		db, err := openHistory(path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		res, err := db.Check()
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("Database:       %s\n", path)
+			fmt.Printf("Schema version: %d (latest %d)\n", res.Version, res.Latest)
+			fmt.Println("Integrity:")
+			for _, msg := range res.Integrity {
+				fmt.Printf("  %s\n", msg)
+			}
+		}
+
+		if !res.OK() {
+			return fmt.Errorf("history database check failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	dbCheckCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+
+	dbCmd.AddCommand(dbCheckCmd)
+	rootCmd.AddCommand(dbCmd)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/scanner"
+)
+
+var (
+	freeTarget string
+	staleAfter string
+	weighCost  bool
+)
+
+// runFreeClean deletes just enough safe junk under root to free the --free
+// target. Without --yes it only prints the plan.
+func runFreeClean(cmd *cobra.Command, root string) error {
+	need, err := config.ParseSize(freeTarget)
+	if err != nil {
+		return err
+	}
+	staleAge, err := config.ParseAge(staleAfter)
+	if err != nil {
+		return err
+	}
+	if shred {
+		return fmt.Errorf("--free doesn't support --shred")
+	}
+	if cmd.Flags().Changed("trash") && trashFlag || quarantine {
+		return fmt.Errorf("--free deletes permanently: moving junk to the trash or quarantine frees no space")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return err
+	}
+	policy, err := scanner.NewPolicy(cfg.Deletion)
+	if err != nil {
+		return err
+	}
+
+	collector := scanner.NewJunkCollector(absRoot, scanner.NewMatcher(cfg.JunkPatterns))
+	results := make(chan scanner.ScanResult, 1000)
+	go scanner.Scan(absRoot, results)
+	for r := range results {
+		if r.Err != nil {
+			continue
+		}
+		collector.Add(r.Entry)
+	}
+	candidates := collector.Candidates(scanner.BudgetOptions{StaleAfter: staleAge, WeighCost: weighCost})
+
+	var db *history.DB
+	if yesFlag {
+		if db, err = openHistory(config.DataPath()); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	cleaner := scanner.NewCleaner(db, false)
+	cleaner.SetPolicy(policy)
+	cleaner.SetGuard(scanner.NewGuard(cfg.Safety))
+	cleaner.SetGitCheck(cfg.Safety.GitCheck)
+	cleaner.SetForce(forceFlag)
+	cleaner.SetRequireHistory(cfg.History.Required)
+	cleaner.SetSizes(collector.Tree())
+	cleaner.SetBatch(history.NewBatchID())
+
+	type skipped struct {
+		Path   string `json:"path"`
+		Reason string `json:"reason"`
+	}
+	type result struct {
+		Path   string `json:"path"`
+		Action string `json:"action"`
+		Error  string `json:"error,omitempty"`
+	}
+	out := struct {
+		Root    string              `json:"root"`
+		Target  int64               `json:"target"`
+		Planned int64               `json:"planned"`
+		Plan    []scanner.Candidate `json:"plan"`
+		Skipped []skipped           `json:"skipped,omitempty"`
+		Freed   int64               `json:"freed,omitempty"`
+		Results []result            `json:"results,omitempty"`
+	}{Root: absRoot, Target: need}
+
+	// Only vet candidates until the target is covered: the safety checks
+	// walk each directory and can be slow
+	var eligible []scanner.Candidate
+	var eligibleSize int64
+	for _, cand := range candidates {
+		if eligibleSize >= need {
+			break
+		}
+		d, err := cleaner.Decide(cand.Path)
+		switch {
+		case err != nil:
+			out.Skipped = append(out.Skipped, skipped{cand.Path, err.Error()})
+			continue
+		case d.Trash:
+			out.Skipped = append(out.Skipped, skipped{cand.Path, "would go to the trash: " + d.Reason})
+			continue
+		}
+		cand.Size = d.Size
+		eligible = append(eligible, cand)
+		eligibleSize += cand.Size
+	}
+	out.Plan, out.Planned = scanner.SelectBudget(eligible, need)
+
+	if !jsonOut {
+		printFreePlan(out.Plan, out.Planned, need)
+		for _, s := range out.Skipped {
+			fmt.Fprintf(os.Stderr, "  skipped %s: %s\n", s.Path, s.Reason)
+		}
+	}
+
+	if !yesFlag || len(out.Plan) == 0 {
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		}
+		if len(out.Plan) > 0 {
+			fmt.Println("Use --yes to delete these permanently.")
+		}
+		return nil
+	}
+
+	// Disk usage can exceed apparent sizes, so the filesystem may report the
+	// target reached before the plan is done
+	startFree, statErr := fsutil.FreeSpace(absRoot)
+	for _, cand := range out.Plan {
+		if statErr == nil {
+			if free, err := fsutil.FreeSpace(absRoot); err == nil && free-startFree >= need {
+				if !jsonOut {
+					fmt.Println("Filesystem reports the target freed; stopping early")
+				}
+				break
+			}
+		}
+
+		d, err := cleaner.Delete(cand.Path)
+		r := result{Path: cand.Path, Action: "deleted"}
+		failed := err != nil && !errors.Is(err, history.ErrNotRecorded)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		if failed {
+			r.Action = "failed"
+		} else {
+			out.Freed += d.Size
+		}
+		out.Results = append(out.Results, r)
+
+		if jsonOut {
+			continue
+		}
+		if failed {
+			fmt.Fprintf(os.Stderr, "failed %s: %v\n", cand.Path, err)
+		} else {
+			fmt.Printf("deleted %s\n", cand.Path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  warning: %v\n", err)
+			}
+		}
+	}
+
+	if statErr == nil {
+		if free, err := fsutil.FreeSpace(absRoot); err == nil && free-startFree > out.Freed {
+			out.Freed = free - startFree
+		}
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	fmt.Printf("Freed %s\n", strings.TrimSpace(formatBytes(out.Freed)))
+	return nil
+}
+
+func printFreePlan(plan []scanner.Candidate, planned, need int64) {
+	if len(plan) == 0 {
+		fmt.Println("No safe junk can be deleted")
+		return
+	}
+
+	for _, cand := range plan {
+		state := "active"
+		if cand.Stale {
+			state = "stale"
+		}
+		fmt.Printf("%s  %-6s  %s  (%s)\n", formatBytes(cand.Size), state, cand.Path, cand.Group)
+	}
+	fmt.Printf("\nPlan: %d items, %s of %s requested\n",
+		len(plan), strings.TrimSpace(formatBytes(planned)), strings.TrimSpace(formatBytes(need)))
+	if planned < need {
+		fmt.Fprintln(os.Stderr, "warning: not enough safe junk to reach the target")
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/scanner"
+)
+
+var (
+	sinceDays      int
+	historyTree    bool
+	historyTypes   []string
+	historyMinSize string
+	historyMaxSize string
+	historyFrom    string
+	historyTo      string
+	historyBatch   string
+	historyPath    string
+	historyText    string
+	reversibleOnly bool
+	statsPeriod    string
+	pruneOlder     string
+	pruneOrphans   bool
+	pruneVacuum    bool
+	exportFormat   string
+	exportOutput   string
+	importFormat   string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [query]",
+	Short: "Search operation history",
+	Long: `Search operation history.
+
+Without a query, --contains, --since, --from or --batch, operations from the
+last 7 days are shown. Filters combine: "breathe history --type delete,shred
+--min-size 1GB" lists large permanent deletions.
+
+The query searches paths, metadata values and operation types, best match
+first. Paths are split into words, and all terms must match unless joined
+by OR:
+
+  report           the word anywhere
+  "old reports"    the phrase
+  rep*             a word starting with rep
+  path:downloads   only in a field: type, source, dest, path (either) or meta
+
+Words match whole; use --contains to find any part of a path, such as
+"port" in "reports".
+
+Dates for --from and --to are YYYY-MM-DD, "YYYY-MM-DD HH:MM" or RFC 3339 in
+local time, or an age like 30d; a date alone for --to includes that day.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := historyFilter(args)
+		if err != nil {
+			return err
+		}
+		if filter.Match == "" && filter.Text == "" && filter.From.IsZero() && filter.BatchID == "" {
+			filter.From = time.Now().AddDate(0, 0, -7)
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if filter.Match != "" && !jsonOut && !historyTree {
+			open, close := "[", "]"
+			if isTerminal(os.Stdout) {
+				open, close = "\033[1m", "\033[0m"
+			}
+			hits, err := db.Hits(filter, open, close)
+			if err != nil {
+				return err
+			}
+			if len(hits) == 0 {
+				fmt.Println("No operations found")
+			}
+			for _, h := range hits {
+				printHit(h)
+			}
+			return nil
+		}
+
+		ops, err := db.Query(filter)
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(ops)
+		}
+
+		if len(ops) == 0 {
+			fmt.Println("No operations found")
+			return nil
+		}
+
+		if historyTree {
+			return printHistoryTree(db, ops)
+		}
+		for _, op := range ops {
+			printOperation(op, "")
+		}
+
+		return nil
+	},
+}
+
+var historyStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize space reclaimed, by period, operation type and junk group",
+	Long: `Summarize space reclaimed, by period, operation type and junk group.
+
+Reclaimed space counts permanent deletes, shreds and purges from the trash
+or quarantine; trashed items still take space until purged. The history
+filters apply, over all time unless --from or --since is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		period := history.Period(statsPeriod)
+		if period != history.PeriodDay && period != history.PeriodWeek {
+			return fmt.Errorf("--by must be day or week")
+		}
+		filter, err := historyFilter(nil)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		matcher := scanner.NewMatcher(cfg.JunkPatterns)
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := db.Query(filter)
+		if err != nil {
+			return err
+		}
+		stats := history.Summarize(ops, period, func(op history.Operation) string {
+			return junkGroup(matcher, op)
+		})
+
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+
+		fmt.Printf("Reclaimed %s in %d operations\n", strings.TrimSpace(formatBytes(stats.Reclaimed)), stats.Operations)
+		printStatsRows("By "+statsPeriod, stats.ByPeriod)
+		printStatsRows("By junk group", stats.ByGroup)
+		printStatsRows("By operation type (all operations)", stats.ByType)
+		return nil
+	},
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old history records",
+	Long: `Delete history records older than history.retention (or --older-than).
+
+Operations that can still be undone are kept while their item is in the
+trash or quarantine, unless history.prune_reversible is set. With --orphans,
+reversible operations whose item is gone are first marked as no longer
+reversible. Everything happens in one transaction; --vacuum then shrinks
+the database file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		retention := cfg.History.Retention
+		if pruneOlder != "" {
+			retention = pruneOlder
+		}
+		opts := history.PruneOptions{
+			KeepReversible: !cfg.History.PruneReversible,
+			Orphans:        pruneOrphans,
+			DryRun:         dryRun,
+		}
+		if retention != "" {
+			age, err := config.ParseAge(retention)
+			if err != nil {
+				return err
+			}
+			opts.Before = time.Now().Add(-age)
+		} else if !pruneOrphans && !pruneVacuum {
+			return fmt.Errorf("set history.retention or pass --older-than")
+		}
+
+		path := config.DataPath()
+		db, err := openHistory(path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		res, err := db.Prune(opts)
+		if err != nil {
+			return err
+		}
+
+		verb := "Pruned"
+		if dryRun {
+			verb = "Would prune"
+		}
+		for _, op := range res.Orphans {
+			fmt.Printf("orphaned %d: %s is gone (%s)\n", op.ID, op.DestPath, op.SourcePath)
+		}
+		// Stay quiet when there was nothing to do, so cron doesn't send mail
+		if res.Pruned > 0 {
+			fmt.Printf("%s %d operations\n", verb, res.Pruned)
+		}
+
+		if pruneVacuum && !dryRun {
+			before := fileSize(path)
+			if err := db.Vacuum(); err != nil {
+				return err
+			}
+			if saved := before - fileSize(path); saved > 0 {
+				fmt.Printf("Compacted the database by %s\n", strings.TrimSpace(formatBytes(saved)))
+			}
+		}
+		return nil
+	},
+}
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export operation history as JSON Lines or CSV",
+	Long: `Export operation history as JSON Lines or CSV, oldest first.
+
+Each JSON line has the same shape as the entries of history --json. CSV has
+the same columns, with metadata as a JSON object. All operations are
+exported unless the history filters are given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := history.Format(exportFormat)
+		if format != history.FormatJSONL && format != history.FormatCSV {
+			return fmt.Errorf("--format must be jsonl or csv")
+		}
+		filter, err := historyFilter(nil)
+		if err != nil {
+			return err
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := db.Query(filter)
+		if err != nil {
+			return err
+		}
+		sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+
+		if exportOutput == "" {
+			return history.Export(os.Stdout, ops, format)
+		}
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			return err
+		}
+		if err := history.Export(f, ops, format); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d operations to %s\n", len(ops), exportOutput)
+		return nil
+	},
+}
+
+var historyImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Merge exported operation history into this machine's",
+	Long: `Merge operations exported with history export, or printed by
+history --json, into the history database. Use - to read stdin.
+
+Imported operations get new IDs, and undo and redo chains are remapped to
+them. Operations already in the database are skipped, so importing the same
+file twice is harmless. Everything is imported in one transaction.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := history.Format(importFormat)
+		if format == "" {
+			format = history.FormatJSONL
+			if strings.EqualFold(filepath.Ext(args[0]), ".csv") {
+				format = history.FormatCSV
+			}
+		}
+
+		in := os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		ops, err := history.ReadExport(in, format)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		res, err := db.Import(ops, dryRun)
+		if err != nil {
+			return err
+		}
+
+		verb := "Imported"
+		if dryRun {
+			verb = "Would import"
+		}
+		fmt.Printf("%s %d operations, skipped %d already recorded\n", verb, res.Imported, res.Duplicates)
+		if res.Orphans > 0 {
+			fmt.Printf("%d can no longer be undone: their items aren't on this machine\n", res.Orphans)
+		}
+		return nil
+	},
+}
+
+var historyVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that recorded history hasn't been edited",
+	Long: `Check that recorded history hasn't been edited.
+
+Each finished operation is sealed into a hash chain: its digest covers what
+was done and the digest of the operation sealed before it. verify recomputes
+the chain and reports the first operation that was edited, inserted or
+removed outside breathe. history prune seals a record of what it removed, so
+operations removed by hand are reported even if their digest was kept.
+Deleting the newest operations, or forging a prune record at the end, can't
+be detected this way, so keep the printed head digest somewhere else to
+compare later.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		res, err := db.Verify()
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		} else if res.Broken == nil {
+			fmt.Printf("Verified %d sealed operations\n", res.Sealed)
+			if res.Head != "" {
+				fmt.Printf("Head: %s\n", res.Head)
+			}
+		}
+
+		if res.Broken != nil {
+			return fmt.Errorf("history %s", res.Broken)
+		}
+		return nil
+	},
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func printStatsRows(title string, rows []history.StatsRow) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, r := range rows {
+		fmt.Printf("  %-20s %s  %d ops\n", r.Key, formatBytes(r.Bytes), r.Operations)
+	}
+}
+
+// junkGroup names the junk pattern an operation's item matched: recorded in
+// its metadata, or else matched against the current config.
+func junkGroup(matcher *scanner.Matcher, op history.Operation) string {
+	if g := op.Metadata["junk_group"]; g != "" {
+		return g
+	}
+	path := op.SourcePath
+	if orig := op.Metadata["original_path"]; orig != "" {
+		path = orig // Purges record where the item was trashed from
+	}
+	if matches := matcher.Match(path); len(matches) > 0 {
+		return matches[0].Name
+	}
+	return ""
+}
+
+// historyFilter builds the filter given by the history flags and query.
+func historyFilter(args []string) (history.Filter, error) {
+	var f history.Filter
+	var err error
+	if len(args) > 0 {
+		f.Match = args[0]
+	}
+	for _, t := range historyTypes {
+		if !history.ValidType(history.OpType(t)) {
+			return f, fmt.Errorf("unknown operation type %q", t)
+		}
+		f.Types = append(f.Types, history.OpType(t))
+	}
+	if historyMinSize != "" {
+		if f.MinSize, err = config.ParseSize(historyMinSize); err != nil {
+			return f, err
+		}
+	}
+	if historyMaxSize != "" {
+		if f.MaxSize, err = config.ParseSize(historyMaxSize); err != nil {
+			return f, err
+		}
+	}
+	if sinceDays > 0 {
+		f.From = time.Now().AddDate(0, 0, -sinceDays)
+	}
+	if historyFrom != "" {
+		if f.From, err = parseDate(historyFrom, false); err != nil {
+			return f, err
+		}
+	}
+	if historyTo != "" {
+		if f.To, err = parseDate(historyTo, true); err != nil {
+			return f, err
+		}
+	}
+	if historyPath != "" {
+		if f.PathPrefix, err = filepath.Abs(config.ExpandHome(historyPath)); err != nil {
+			return f, err
+		}
+	}
+	f.Reversible = reversibleOnly
+	f.BatchID = historyBatch
+	f.Text = historyText
+	return f, nil
+}
+
+// parseDate parses a local date or time, or an age before now. With end, a
+// bare date means the end of that day.
+func parseDate(s string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if age, err := config.ParseAge(s); err == nil {
+		return time.Now().Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func printOperation(op history.Operation, indent string) {
+	if op.Type == history.OpPrune {
+		fmt.Printf("%s%d | %s | prune | %s operations\n", indent, op.ID, op.Timestamp.Format("2006-01-02 15:04"), op.Metadata["count"])
+		return
+	}
+	fmt.Printf("%s%d | %s | %s | %s",
+		indent,
+		op.ID,
+		op.Timestamp.Format("2006-01-02 15:04"),
+		op.Type,
+		filepath.Base(op.SourcePath))
+	if op.DestPath != "" {
+		fmt.Printf(" -> %s", op.DestPath)
+	}
+	if op.State != history.StateApplied {
+		fmt.Printf(" [%s]", op.State)
+	}
+	if origin := op.Metadata["origin"]; origin != "" {
+		fmt.Printf(" (%s)", origin)
+	}
+	fmt.Println()
+}
+
+// printHit prints an operation found by a search with the matches marked.
+func printHit(h history.Hit) {
+	fmt.Printf("%d | %s | %s | %s", h.ID, h.Timestamp.Format("2006-01-02 15:04"), h.Type, h.Source)
+	if h.Dest != "" {
+		fmt.Printf(" -> %s", h.Dest)
+	}
+	if h.State != history.StateApplied {
+		fmt.Printf(" [%s]", h.State)
+	}
+	if origin := h.Metadata["origin"]; origin != "" {
+		fmt.Printf(" (%s)", origin)
+	}
+	fmt.Println()
+	if h.Meta != "" {
+		fmt.Printf("    %s\n", h.Meta)
+	}
+}
+
+// printHistoryTree shows each operation with the undos and redos that
+// followed it, starting from the operation that began each chain.
+func printHistoryTree(db *history.DB, ops []history.Operation) error {
+	all, err := db.Chains(ops)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]history.Operation, len(all))
+	inverses := make(map[int64][]history.Operation)
+	for _, op := range all {
+		byID[op.ID] = op
+		if op.InverseOf != 0 {
+			inverses[op.InverseOf] = append(inverses[op.InverseOf], op)
+		}
+	}
+
+	seen := make(map[int64]bool)
+	for _, op := range ops {
+		// Inverses are always recorded after what they invert
+		root := op
+		for root.InverseOf != 0 && root.InverseOf < root.ID {
+			parent, ok := byID[root.InverseOf]
+			if !ok {
+				break // Pruned
+			}
+			root = parent
+		}
+		if seen[root.ID] {
+			continue
+		}
+		seen[root.ID] = true
+		printChain(root, inverses, "")
+	}
+	return nil
+}
+
+func printChain(op history.Operation, inverses map[int64][]history.Operation, indent string) {
+	prefix := ""
+	if indent != "" {
+		prefix = "└ "
+	}
+	printOperation(op, indent+prefix)
+	for _, inv := range inverses[op.ID] {
+		printChain(inv, inverses, indent+"  ")
+	}
+}
+
+func addHistoryFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&sinceDays, "since", 0, "show operations from last N days")
+	cmd.Flags().StringSliceVar(&historyTypes, "type", nil, "only these operation types (e.g. delete,trash)")
+	cmd.Flags().StringVar(&historyMinSize, "min-size", "", "only operations on items at least this large (e.g. 100MB)")
+	cmd.Flags().StringVar(&historyMaxSize, "max-size", "", "only operations on items at most this large")
+	cmd.Flags().StringVar(&historyFrom, "from", "", "only operations at or after this date")
+	cmd.Flags().StringVar(&historyTo, "to", "", "only operations before this date, or on it for a bare date")
+	cmd.Flags().BoolVar(&reversibleOnly, "reversible", false, "only operations that can still be undone")
+	cmd.Flags().StringVar(&historyBatch, "batch", "", "only operations of this batch")
+	cmd.Flags().StringVar(&historyPath, "path", "", "only operations on this path or anything under it")
+	cmd.Flags().StringVar(&historyText, "contains", "", "only operations whose source or destination path contains this text")
+}
+
+func init() {
+	addHistoryFilterFlags(historyCmd)
+	historyCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+	historyCmd.Flags().BoolVar(&historyTree, "tree", false, "show undos and redos under the operation they follow")
+
+	addHistoryFilterFlags(historyStatsCmd)
+	historyStatsCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+	historyStatsCmd.Flags().StringVar(&statsPeriod, "by", "week", "reclaimed space per day or week")
+
+	historyPruneCmd.Flags().StringVar(&pruneOlder, "older-than", "", "prune operations older than this, e.g. 90d (default history.retention)")
+	historyPruneCmd.Flags().BoolVar(&pruneOrphans, "orphans", false, "mark reversible operations whose item is gone as no longer reversible")
+	historyPruneCmd.Flags().BoolVar(&pruneVacuum, "vacuum", false, "compact the database file afterwards")
+	historyPruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be pruned")
+
+	addHistoryFilterFlags(historyExportCmd)
+	historyExportCmd.Flags().StringVar(&exportFormat, "format", "jsonl", "jsonl or csv")
+	historyExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "write to this file instead of stdout")
+
+	historyImportCmd.Flags().StringVar(&importFormat, "format", "", "jsonl or csv (default from the file extension)")
+	historyImportCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be imported")
+
+	historyVerifyCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+
+	historyCmd.AddCommand(historyStatsCmd, historyPruneCmd, historyExportCmd, historyImportCmd, historyVerifyCmd)
+	rootCmd.AddCommand(historyCmd)
+}
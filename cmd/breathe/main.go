@@ -2,32 +2,39 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
 	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/openfiles"
 	"github.com/0xjjjjjj/breathe/internal/organizer"
 	"github.com/0xjjjjjj/breathe/internal/scanner"
 	"github.com/0xjjjjjj/breathe/internal/tui"
 )
 
 var (
-	cfgFile    string
-	jsonOut    bool
-	junkOnly   bool
-	dryRun     bool
-	apply      bool
-	plan       bool
-	sinceDays  int
-	yesFlag    bool
-	trashFlag  bool
-	patternArg string
-	topLevel   bool // Quick top-level scan only
+	cfgFile     string
+	jsonOut     bool
+	junkOnly    bool
+	dryRun      bool
+	apply       bool
+	plan        bool
+	yesFlag     bool
+	trashFlag   bool
+	patternArg  string
+	topLevel    bool // Quick top-level scan only
+	forceFlag   bool
+	openDeleted bool
+	quarantine  bool
+	shred       bool
+	shredPasses int
 )
 
 var rootCmd = &cobra.Command{
@@ -56,16 +63,28 @@ var scanCmd = &cobra.Command{
 			return err
 		}
 
+		if openDeleted {
+			return runOpenDeletedScan(absPath)
+		}
+
 		// Quick top-level scan using du (much faster for large dirs)
 		if topLevel {
 			return runTopLevelScan(absPath)
 		}
 
+		if junkOnly && (jsonOut || !isTerminal(os.Stdout)) {
+			return runJunkScan(cfg, absPath)
+		}
+
 		if jsonOut {
 			return runJSONScan(cfg, absPath)
 		}
 
-		return tui.Run(cfg, absPath)
+		view := tui.ViewScan
+		if junkOnly {
+			view = tui.ViewJunk
+		}
+		return tui.Run(cfg, absPath, view)
 	},
 }
 
@@ -172,6 +191,116 @@ func runJSONScan(cfg *config.Config, path string) error {
 	return tree.ToJSON(os.Stdout, matcher, 3)
 }
 
+// runOpenDeletedScan lists files under path that were deleted but are still
+// held open, a common cause of disk usage that no scan can find.
+func runOpenDeletedScan(path string) error {
+	files, err := openfiles.Deleted(path)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No deleted files are being held open")
+		return nil
+	}
+
+	var total int64
+	for _, f := range files {
+		fmt.Printf("%s  pid %d (%s) fd %d  %s\n", formatBytes(f.Size), f.PID, f.Command, f.FD, f.Path)
+		total += f.Size
+	}
+	fmt.Printf("\n%s held by %d deleted files; restart or signal the processes to free it\n",
+		strings.TrimSpace(formatBytes(total)), len(files))
+	return nil
+}
+
+// runJunkScan sizes only junk, either as JSON or as a text summary table.
+func runJunkScan(cfg *config.Config, path string) error {
+	collector := scanner.NewJunkCollector(path, scanner.NewMatcher(cfg.JunkPatterns))
+	results := make(chan scanner.ScanResult, 1000)
+
+	go scanner.Scan(path, results)
+
+	for r := range results {
+		if r.Err != nil {
+			continue
+		}
+		collector.Add(r.Entry)
+	}
+
+	if jsonOut {
+		return collector.ToJSON(os.Stdout)
+	}
+
+	tree := collector.Tree()
+	groups := collector.Groups()
+
+	fmt.Printf("Junk in %s (%s scanned, %d files)\n\n", path, strings.TrimSpace(formatBytes(tree.Root().Size)), collector.FileCount())
+	if len(groups) == 0 {
+		fmt.Println("No junk detected")
+		return nil
+	}
+
+	var total int64
+	for _, g := range groups {
+		safeIcon := "✓"
+		if !g.Safe {
+			safeIcon = "⚠"
+		}
+		fmt.Printf("[%s] %s  %s (%d paths)\n", safeIcon, formatBytes(g.Total), g.Name, len(g.Paths))
+		for i, p := range g.Paths {
+			if i >= 5 {
+				fmt.Printf("      ... and %d more\n", len(g.Paths)-5)
+				break
+			}
+			var size int64
+			if node := tree.Get(p); node != nil {
+				size = node.Size
+			}
+			fmt.Printf("      %s  %s\n", formatBytes(size), p)
+		}
+		total += g.Total
+	}
+	fmt.Printf("\nTotal junk: %s\n", formatBytes(total))
+
+	return nil
+}
+
+// progressPrinter returns a callback that shows cross-device copy progress on
+// stderr, or nil when stderr isn't a terminal.
+func progressPrinter() func(fsutil.Progress) {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+	return func(p fsutil.Progress) {
+		fmt.Fprintf(os.Stderr, "\rcopying %d/%d files (%s of %s)",
+			p.FilesDone, p.FilesTotal,
+			strings.TrimSpace(formatBytes(p.BytesDone)), strings.TrimSpace(formatBytes(p.BytesTotal)))
+		if p.FilesDone == p.FilesTotal {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 var organizeCmd = &cobra.Command{
 	Use:   "organize [path]",
 	Short: "Organize files by type",
@@ -208,14 +337,17 @@ var organizeCmd = &cobra.Command{
 		}
 
 		if apply {
-			db, err := history.Open(config.DataPath())
+			db, err := openHistory(config.DataPath())
 			if err != nil {
 				return err
 			}
 			defer db.Close()
 
 			exec := organizer.NewExecutor(db, false)
-			return exec.Execute(p)
+			exec.SetRequireHistory(cfg.History.Required)
+			err = exec.Execute(p)
+			fmt.Printf("Batch %s (undo with: breathe undo --batch %s)\n", exec.BatchID(), exec.BatchID())
+			return err
 		}
 
 		fmt.Printf("Would organize %d files. Use --plan to see details, --dry-run to preview, or --apply to execute.\n", len(p.Files))
@@ -239,139 +371,159 @@ func outputPlan(p *organizer.Plan) error {
 	return nil
 }
 
-var historyCmd = &cobra.Command{
-	Use:   "history [query]",
-	Short: "Search operation history",
-	Args:  cobra.MaximumNArgs(1),
+var cleanCmd = &cobra.Command{
+	Use:   "clean <paths...>",
+	Short: "Delete files or directories",
+	Long: `Delete files or directories.
+
+With --free, the single argument is a root to search for safe junk instead:
+breathe deletes the fewest stale, then active, junk directories needed to
+free the requested space and shows the plan unless --yes is given.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		db, err := history.Open(config.DataPath())
-		if err != nil {
-			return err
+		if freeTarget != "" {
+			if len(args) != 1 {
+				return fmt.Errorf("--free takes a single root directory")
+			}
+			return runFreeClean(cmd, args[0])
 		}
-		defer db.Close()
 
-		var ops []history.Operation
-
-		if len(args) > 0 {
-			ops, err = db.Search(args[0])
-		} else if sinceDays > 0 {
-			since := time.Now().AddDate(0, 0, -sinceDays)
-			ops, err = db.Since(since)
-		} else {
-			since := time.Now().AddDate(0, 0, -7)
-			ops, err = db.Since(since)
+		if !yesFlag {
+			return fmt.Errorf("use --yes to confirm deletion")
 		}
 
+		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
 		}
 
-		if jsonOut {
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "  ")
-			return enc.Encode(ops)
-		}
-
-		if len(ops) == 0 {
-			fmt.Println("No operations found")
-			return nil
-		}
-
-		for _, op := range ops {
-			fmt.Printf("%d | %s | %s | %s",
-				op.ID,
-				op.Timestamp.Format("2006-01-02 15:04"),
-				op.Type,
-				filepath.Base(op.SourcePath))
-			if op.DestPath != "" {
-				fmt.Printf(" -> %s", op.DestPath)
-			}
-			fmt.Println()
-		}
-
-		return nil
-	},
-}
-
-var undoCmd = &cobra.Command{
-	Use:   "undo <id>",
-	Short: "Undo an operation",
-	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		id, err := strconv.ParseInt(args[0], 10, 64)
+		policy, err := scanner.NewPolicy(cfg.Deletion)
 		if err != nil {
-			return fmt.Errorf("invalid operation ID: %s", args[0])
+			return err
 		}
 
-		db, err := history.Open(config.DataPath())
+		db, err := openHistory(config.DataPath())
 		if err != nil {
 			return err
 		}
 		defer db.Close()
 
-		op, err := db.Get(id)
-		if err != nil {
-			return fmt.Errorf("operation not found: %d", id)
-		}
-
-		if !op.Reversible {
-			return fmt.Errorf("operation %d is not reversible", id)
-		}
-
-		switch op.Type {
-		case history.OpMove:
-			if err := os.Rename(op.DestPath, op.SourcePath); err != nil {
-				return err
+		cleaner := scanner.NewCleaner(db, trashFlag)
+		cleaner.SetPolicy(policy)
+		cleaner.SetGuard(scanner.NewGuard(cfg.Safety))
+		cleaner.SetGitCheck(cfg.Safety.GitCheck)
+		cleaner.SetForce(forceFlag)
+		cleaner.SetRequireHistory(cfg.History.Required)
+		batchID := history.NewBatchID()
+		cleaner.SetBatch(batchID)
+		if shred {
+			if quarantine {
+				return fmt.Errorf("--shred and --quarantine can't be combined")
 			}
-			fmt.Printf("Moved %s back to %s\n", op.DestPath, op.SourcePath)
-		case history.OpTrash:
-			if err := os.Rename(op.DestPath, op.SourcePath); err != nil {
-				return err
+			passes := shredPasses
+			if passes == 0 {
+				passes = cfg.Deletion.ShredPasses
 			}
-			fmt.Printf("Restored %s from trash\n", op.SourcePath)
-		default:
-			return fmt.Errorf("cannot undo operation type: %s", op.Type)
+			if passes == 0 {
+				passes = config.DefaultConfig().Deletion.ShredPasses
+			}
+			cleaner.SetShred(passes)
 		}
-
-		return nil
-	},
-}
-
-var cleanCmd = &cobra.Command{
-	Use:   "clean <paths...>",
-	Short: "Delete files or directories",
-	Args:  cobra.MinimumNArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if !yesFlag {
-			return fmt.Errorf("use --yes to confirm deletion")
+		if quarantine {
+			q, err := newQuarantine(cfg)
+			if err != nil {
+				return err
+			}
+			cleaner.SetQuarantine(q)
 		}
 
-		db, err := history.Open(config.DataPath())
-		if err != nil {
-			return err
+		type result struct {
+			scanner.Decision
+			Action string `json:"action"`
+			Error  string `json:"error,omitempty"`
 		}
-		defer db.Close()
-
-		cleaner := scanner.NewCleaner(db, trashFlag)
 
+		var paths []string
 		for _, path := range args {
 			absPath, err := filepath.Abs(path)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "skip %s: %v\n", path, err)
 				continue
 			}
+			paths = append(paths, absPath)
+		}
+
+		deletes := make(chan scanner.DeleteResult)
+		go cleaner.DeleteAll(paths, scanner.DeleteWorkers, deletes)
+
+		// Results arrive in completion order; keep JSON in argument order
+		results := make([]result, len(paths))
+		showProgress := !jsonOut && isTerminal(os.Stderr)
+		var done, reversible, unrecorded int
+		var removed int64
+		for dr := range deletes {
+			d, err := dr.Decision, dr.Err
+			r := result{Decision: d, Action: "deleted"}
+			if d.Trash {
+				r.Action = "trashed"
+			} else if d.Quarantine {
+				r.Action = "quarantined"
+			} else if d.Shred {
+				r.Action = "shredded"
+			}
+			// An unrecorded operation still happened, so report it as done
+			failed := err != nil && !errors.Is(err, history.ErrNotRecorded)
+			if err != nil {
+				r.Error = err.Error()
+			}
+			if failed {
+				r.Action = "failed"
+			} else {
+				removed += d.Size
+				if err != nil {
+					unrecorded++
+				} else if d.Trash || d.Quarantine {
+					reversible++
+				}
+			}
+			results[dr.Index] = r
+			done++
 
-			if err := cleaner.Delete(absPath); err != nil {
-				fmt.Fprintf(os.Stderr, "failed %s: %v\n", path, err)
+			if jsonOut {
+				continue
+			}
+			if showProgress {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+			}
+			if failed {
+				fmt.Fprintf(os.Stderr, "failed %s: %v\n", paths[dr.Index], err)
 			} else {
-				action := "deleted"
-				if trashFlag {
-					action = "trashed"
+				fmt.Printf("%s %s (%s)\n", r.Action, paths[dr.Index], d.Reason)
+				for _, w := range d.Warnings {
+					fmt.Fprintf(os.Stderr, "  warning: %s\n", w)
 				}
-				fmt.Printf("%s %s\n", action, absPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "  warning: %v\n", err)
+				}
+			}
+			if showProgress && done < len(paths) {
+				fmt.Fprintf(os.Stderr, "deleting: %d/%d done (%s)", done, len(paths), strings.TrimSpace(formatBytes(removed)))
 			}
 		}
 
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				return err
+			}
+		} else if reversible > 0 {
+			fmt.Printf("Batch %s (undo with: breathe undo --batch %s)\n", batchID, batchID)
+		}
+
+		if unrecorded > 0 {
+			return fmt.Errorf("%d operations are missing from history and can't be undone with breathe", unrecorded)
+		}
 		return nil
 	},
 }
@@ -380,8 +532,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default ~/.config/breathe/config.yaml)")
 
 	scanCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
-	scanCmd.Flags().BoolVar(&junkOnly, "junk", false, "show only detected junk")
+	scanCmd.Flags().BoolVar(&junkOnly, "junk", false, "show only detected junk (TUI junk view, or a summary when piped or with --json)")
 	scanCmd.Flags().BoolVar(&topLevel, "top", false, "quick top-level scan only (faster for large dirs)")
+	scanCmd.Flags().BoolVar(&openDeleted, "open-deleted", false, "list deleted files still held open by processes")
 	rootCmd.AddCommand(scanCmd)
 
 	organizeCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would happen")
@@ -390,15 +543,17 @@ func init() {
 	organizeCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
 	rootCmd.AddCommand(organizeCmd)
 
-	historyCmd.Flags().IntVar(&sinceDays, "since", 0, "show operations from last N days")
-	historyCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
-	rootCmd.AddCommand(historyCmd)
-
-	rootCmd.AddCommand(undoCmd)
-
 	cleanCmd.Flags().BoolVar(&yesFlag, "yes", false, "confirm deletion")
 	cleanCmd.Flags().BoolVar(&trashFlag, "trash", true, "move to trash instead of permanent delete")
+	cleanCmd.Flags().BoolVar(&quarantine, "quarantine", false, "move to breathe's quarantine, purged after deletion.quarantine_ttl")
+	cleanCmd.Flags().BoolVar(&shred, "shred", false, "overwrite file contents before deleting, and record their hashes")
+	cleanCmd.Flags().IntVar(&shredPasses, "shred-passes", 0, "overwrite passes for --shred (default deletion.shred_passes)")
+	cleanCmd.Flags().BoolVar(&forceFlag, "force", false, "delete even if processes have files open or git repositories have unsaved work")
 	cleanCmd.Flags().StringVar(&patternArg, "pattern", "", "match junk pattern name")
+	cleanCmd.Flags().BoolVar(&jsonOut, "json", false, "output results as JSON")
+	cleanCmd.Flags().StringVar(&freeTarget, "free", "", "delete safe junk under the root until this much is freed (e.g. 20GB)")
+	cleanCmd.Flags().StringVar(&staleAfter, "stale-after", "30d", "with --free, junk untouched this long is deleted first")
+	cleanCmd.Flags().BoolVar(&weighCost, "weigh-cost", false, "with --free, prefer junk that is cheap to regenerate")
 	rootCmd.AddCommand(cleanCmd)
 }
 
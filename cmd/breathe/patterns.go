@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/scanner"
+)
+
+var patternsCmd = &cobra.Command{
+	Use:   "patterns",
+	Short: "Test and debug junk patterns",
+}
+
+var patternsTestCmd = &cobra.Command{
+	Use:   "test <pattern> <path>",
+	Short: "Check whether a pattern matches a path",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+
+		e := scanner.ExplainPattern(config.JunkPattern{Pattern: args[0]}, path)
+		if jsonOut {
+			return printExplanations(path, []scanner.Explanation{e})
+		}
+
+		printExplanation(e)
+		if e.Err != nil {
+			return e.Err
+		}
+		return nil
+	},
+}
+
+var patternsExplainCmd = &cobra.Command{
+	Use:   "explain <path>",
+	Short: "Show which configured junk patterns match a path and why",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+
+		// Load without validation so invalid patterns show up in the report
+		cfg, err := config.LoadUnvalidated(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		explanations := scanner.NewMatcher(cfg.JunkPatterns).Explain(path)
+		if jsonOut {
+			return printExplanations(path, explanations)
+		}
+
+		fmt.Println(path)
+		matched := 0
+		for _, e := range explanations {
+			printExplanation(e)
+			if e.Matched {
+				matched++
+			}
+		}
+		fmt.Printf("\n%d of %d patterns match\n", matched, len(explanations))
+		return nil
+	},
+}
+
+var patternsLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Validate every junk pattern in the config",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadUnvalidated(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		invalid := 0
+		for _, p := range cfg.JunkPatterns {
+			if err := config.ValidatePattern(p); err != nil {
+				fmt.Printf("✗ %s: %v\n", p.Name, err)
+				invalid++
+				continue
+			}
+			warnings := scanner.PatternWarnings(p)
+			if len(warnings) == 0 {
+				fmt.Printf("✓ %s: %s\n", p.Name, p.Pattern)
+				continue
+			}
+			for _, w := range warnings {
+				fmt.Printf("⚠ %s: %s: %s\n", p.Name, p.Pattern, w)
+			}
+		}
+
+		if invalid > 0 {
+			return fmt.Errorf("%d invalid pattern(s)", invalid)
+		}
+		return nil
+	},
+}
+
+func printExplanation(e scanner.Explanation) {
+	icon := "✗"
+	if e.Matched {
+		icon = "✓"
+	}
+	name := e.Pattern.Name
+	if name == "" {
+		name = e.Pattern.Pattern
+	}
+	fmt.Printf("%s %s (%s): %s\n", icon, name, e.Pattern.Pattern, e.Reason)
+}
+
+func printExplanations(path string, explanations []scanner.Explanation) error {
+	type result struct {
+		Name    string `json:"name,omitempty"`
+		Pattern string `json:"pattern"`
+		Matched bool   `json:"matched"`
+		Error   string `json:"error,omitempty"`
+		Reason  string `json:"reason"`
+	}
+
+	results := make([]result, 0, len(explanations))
+	for _, e := range explanations {
+		r := result{
+			Name:    e.Pattern.Name,
+			Pattern: e.Pattern.Pattern,
+			Matched: e.Matched,
+			Reason:  e.Reason,
+		}
+		if e.Err != nil {
+			r.Error = e.Err.Error()
+		}
+		results = append(results, r)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"path": path, "patterns": results})
+}
+
+func init() {
+	patternsTestCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+	patternsExplainCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+	patternsCmd.AddCommand(patternsTestCmd, patternsExplainCmd, patternsLintCmd)
+	rootCmd.AddCommand(patternsCmd)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage items held in quarantine by clean --quarantine",
+	Long: `Manage items held in quarantine by clean --quarantine.
+
+Quarantined items can be restored with "breathe undo <id>" until they expire.
+Run "breathe quarantine purge" regularly (e.g. from cron) to delete expired items.`,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined items",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := quarantinedOps(db)
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			type item struct {
+				ID             int64     `json:"id"`
+				OriginalPath   string    `json:"original_path"`
+				QuarantinePath string    `json:"quarantine_path"`
+				QuarantinedAt  time.Time `json:"quarantined_at"`
+				ExpiresAt      time.Time `json:"expires_at"`
+				Size           int64     `json:"size"`
+			}
+			items := make([]item, 0, len(ops))
+			for _, op := range ops {
+				items = append(items, item{op.ID, op.SourcePath, op.DestPath, op.Timestamp, expiresAt(op), op.FileSize})
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(items)
+		}
+
+		if len(ops) == 0 {
+			fmt.Println("Quarantine is empty")
+			return nil
+		}
+
+		var total int64
+		for _, op := range ops {
+			fmt.Printf("%d | expires %s | %s | %s\n",
+				op.ID,
+				expiresAt(op).Local().Format("2006-01-02 15:04"),
+				formatBytes(op.FileSize),
+				op.SourcePath)
+			total += op.FileSize
+		}
+		fmt.Printf("\n%d items, %s\n", len(ops), formatBytes(total))
+		return nil
+	},
+}
+
+var quarantinePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently delete expired quarantined items",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := quarantinedOps(db)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var freed int64
+		purged, failed := 0, 0
+		for _, op := range ops {
+			if expiresAt(op).After(now) {
+				continue
+			}
+			if dryRun {
+				fmt.Printf("would purge %s (%s)\n", op.SourcePath, op.DestPath)
+				continue
+			}
+
+			purge := history.Operation{
+				Type:       history.OpPurge,
+				SourcePath: op.DestPath,
+				FileSize:   op.FileSize,
+				Metadata:   map[string]string{"original_path": op.SourcePath},
+				InverseOf:  op.ID,
+			}
+			id, err := db.Begin(purge)
+			if err != nil {
+				return err
+			}
+			if err := trash.PurgeQuarantined(op.DestPath); err != nil {
+				db.Fail(id, err)
+				fmt.Fprintf(os.Stderr, "failed %s: %v\n", op.DestPath, err)
+				failed++
+				continue
+			}
+			if err := db.Complete(id, purge); err != nil {
+				return err
+			}
+			freed += op.FileSize
+			purged++
+		}
+
+		// Stay quiet when there was nothing to do, so cron doesn't send mail
+		if purged > 0 {
+			fmt.Printf("Purged %d expired items, freed %s\n", purged, formatBytes(freed))
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to purge %d items", failed)
+		}
+		return nil
+	},
+}
+
+// newQuarantine returns the quarantine configured by deletion.quarantine_ttl.
+func newQuarantine(cfg *config.Config) (*trash.Quarantine, error) {
+	ttl := cfg.Deletion.QuarantineTTL
+	if ttl == "" {
+		ttl = config.DefaultConfig().Deletion.QuarantineTTL
+	}
+	age, err := config.ParseAge(ttl)
+	if err != nil {
+		return nil, err
+	}
+	return trash.NewQuarantine(config.QuarantinePath(), age, nil), nil
+}
+
+// quarantinedOps returns quarantine operations whose item is still in
+// quarantine, newest first.
+func quarantinedOps(db *history.DB) ([]history.Operation, error) {
+	ops, err := db.Reversible(history.OpQuarantine)
+	if err != nil {
+		return nil, err
+	}
+
+	present := ops[:0]
+	for _, op := range ops {
+		if _, err := os.Lstat(op.DestPath); err == nil {
+			present = append(present, op)
+		}
+	}
+	return present, nil
+}
+
+// expiresAt returns when a quarantined item expires. Records without a valid
+// expiry are treated as already expired.
+func expiresAt(op history.Operation) time.Time {
+	t, _ := time.Parse(time.RFC3339, op.Metadata["expires_at"])
+	return t
+}
+
+func init() {
+	quarantineListCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+	quarantinePurgeCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be purged")
+
+	quarantineCmd.AddCommand(quarantineListCmd, quarantinePurgeCmd)
+	rootCmd.AddCommand(quarantineCmd)
+}
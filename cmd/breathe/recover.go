@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/history"
+)
+
+// openHistory opens the history database at path and reports on stderr any
+// interrupted operations that opening it recovered.
+func openHistory(path string) (*history.DB, error) {
+	db, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if recovered := db.Recovered(); len(recovered) > 0 {
+		fmt.Fprintf(os.Stderr, "Recovered %d interrupted operations:\n", len(recovered))
+		printRecoveries(os.Stderr, recovered)
+	}
+	return db, nil
+}
+
+func printRecoveries(w io.Writer, recovered []history.Recovery) {
+	for _, r := range recovered {
+		outcome := "failed"
+		if r.Completed {
+			outcome = "completed"
+		}
+		fmt.Fprintf(w, "  #%d %-9s %s %s: %s\n", r.Op.ID, outcome, r.Op.Type, r.Op.SourcePath, r.Reason)
+	}
+}
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Reconcile operations interrupted before they were recorded",
+	Long: `Reconcile operations interrupted before they were recorded.
+
+breathe records each operation as pending before touching the filesystem and
+completes the record afterwards. If it is killed in between, the next command
+that opens the history checks the filesystem: operations whose effect is in
+place are completed, so they can be undone, and the rest are marked failed.
+This command runs that check and also lists pending operations of breathe
+processes that are still running.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := history.Open(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		pending, err := db.Pending()
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(struct {
+				Recovered []history.Recovery  `json:"recovered"`
+				Pending   []history.Operation `json:"pending"`
+			}{db.Recovered(), pending})
+		}
+
+		if len(db.Recovered()) == 0 && len(pending) == 0 {
+			fmt.Println("Nothing to recover")
+			return nil
+		}
+		if recovered := db.Recovered(); len(recovered) > 0 {
+			fmt.Printf("Recovered %d interrupted operations:\n", len(recovered))
+			printRecoveries(os.Stdout, recovered)
+		}
+		if len(pending) > 0 {
+			fmt.Printf("%d operations are still in progress:\n", len(pending))
+			for _, op := range pending {
+				fmt.Printf("  #%d %s %s (pid %s)\n", op.ID, op.Type, op.SourcePath, op.Metadata["pid"])
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	recoverCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+
+	rootCmd.AddCommand(recoverCmd)
+}
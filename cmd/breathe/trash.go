@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+var (
+	olderThan  string
+	largerThan string
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage items breathe moved to the trash",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trashed items",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := trashedOps(db)
+		if err != nil {
+			return err
+		}
+
+		if jsonOut {
+			type item struct {
+				ID           int64     `json:"id"`
+				OriginalPath string    `json:"original_path"`
+				TrashPath    string    `json:"trash_path"`
+				DeletedAt    time.Time `json:"deleted_at"`
+				Size         int64     `json:"size"`
+			}
+			items := make([]item, 0, len(ops))
+			for _, op := range ops {
+				items = append(items, item{op.ID, op.SourcePath, op.DestPath, op.Timestamp, op.FileSize})
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(items)
+		}
+
+		if len(ops) == 0 {
+			fmt.Println("Trash is empty")
+			return nil
+		}
+
+		var total int64
+		for _, op := range ops {
+			fmt.Printf("%d | %s | %s | %s\n",
+				op.ID,
+				op.Timestamp.Format("2006-01-02 15:04"),
+				formatBytes(op.FileSize),
+				op.SourcePath)
+			total += op.FileSize
+		}
+		fmt.Printf("\n%d items, %s\n", len(ops), formatBytes(total))
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <path|id>",
+	Short: "Restore a trashed item to its original location",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		op, err := findTrashedOp(db, args[0])
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Lstat(op.SourcePath); err == nil {
+			return fmt.Errorf("cannot restore: %s already exists", op.SourcePath)
+		}
+		if err := os.MkdirAll(filepath.Dir(op.SourcePath), 0755); err != nil {
+			return err
+		}
+
+		restore := history.Operation{
+			Type:       history.OpRestore,
+			SourcePath: op.DestPath,
+			DestPath:   op.SourcePath,
+			FileSize:   op.FileSize,
+			InverseOf:  op.ID,
+		}
+		id, err := db.Begin(restore)
+		if err != nil {
+			return err
+		}
+
+		mover := fsutil.NewMover()
+		mover.OnProgress = progressPrinter()
+		// A partial move restored the item but left some of it in the trash
+		restoreErr := trash.Restore(mover, op.DestPath, op.SourcePath)
+		var partial *fsutil.PartialMoveError
+		if restoreErr != nil && !errors.As(restoreErr, &partial) {
+			db.Fail(id, restoreErr)
+			return restoreErr
+		}
+
+		if err := db.Complete(id, restore); err != nil {
+			return err
+		}
+
+		fmt.Printf("Restored %s\n", op.SourcePath)
+		return restoreErr
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete trashed items",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var minAge time.Duration
+		var minSize int64
+		var err error
+		if olderThan != "" {
+			if minAge, err = config.ParseAge(olderThan); err != nil {
+				return err
+			}
+		}
+		if largerThan != "" {
+			if minSize, err = config.ParseSize(largerThan); err != nil {
+				return err
+			}
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		ops, err := trashedOps(db)
+		if err != nil {
+			return err
+		}
+
+		var selected []history.Operation
+		var total int64
+		for _, op := range ops {
+			if minAge > 0 && time.Since(op.Timestamp) < minAge {
+				continue
+			}
+			if minSize > 0 && op.FileSize < minSize {
+				continue
+			}
+			selected = append(selected, op)
+			total += op.FileSize
+		}
+
+		if len(selected) == 0 {
+			fmt.Println("Nothing to purge")
+			return nil
+		}
+
+		if !yesFlag {
+			for _, op := range selected {
+				fmt.Printf("%s  %s\n", formatBytes(op.FileSize), op.SourcePath)
+			}
+			fmt.Printf("\nWould purge %d items (%s). Use --yes to confirm.\n", len(selected), formatBytes(total))
+			return nil
+		}
+
+		var freed int64
+		purged := 0
+		for _, op := range selected {
+			purge := history.Operation{
+				Type:       history.OpPurge,
+				SourcePath: op.DestPath,
+				FileSize:   op.FileSize,
+				Metadata:   map[string]string{"original_path": op.SourcePath},
+				InverseOf:  op.ID,
+			}
+			id, err := db.Begin(purge)
+			if err != nil {
+				return err
+			}
+			if err := trash.Purge(op.DestPath); err != nil {
+				db.Fail(id, err)
+				fmt.Fprintf(os.Stderr, "failed %s: %v\n", op.DestPath, err)
+				continue
+			}
+			if err := db.Complete(id, purge); err != nil {
+				return err
+			}
+			freed += op.FileSize
+			purged++
+		}
+
+		fmt.Printf("Purged %d items, freed %s\n", purged, formatBytes(freed))
+		return nil
+	},
+}
+
+// trashedOps returns trash operations that can still be restored and whose
+// item is still in the trash.
+func trashedOps(db *history.DB) ([]history.Operation, error) {
+	ops, err := db.Reversible(history.OpTrash)
+	if err != nil {
+		return nil, err
+	}
+
+	present := ops[:0]
+	for _, op := range ops {
+		if _, err := os.Lstat(op.DestPath); err == nil {
+			present = append(present, op)
+		}
+	}
+	return present, nil
+}
+
+// findTrashedOp resolves a history ID, original path or trash path to the
+// trash operation it refers to.
+func findTrashedOp(db *history.DB, arg string) (*history.Operation, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		op, err := db.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("operation not found: %d", id)
+		}
+		if op.Type != history.OpTrash || !op.Reversible {
+			return nil, fmt.Errorf("operation %d is not a restorable trash operation", id)
+		}
+		return op, nil
+	}
+
+	path, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := trashedOps(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.SourcePath == path || op.DestPath == path {
+			return &op, nil
+		}
+	}
+	return nil, fmt.Errorf("no trashed item for %s", path)
+}
+
+func init() {
+	trashListCmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
+
+	trashEmptyCmd.Flags().StringVar(&olderThan, "older-than", "", "only items trashed longer ago than this (e.g. 30d, 2w)")
+	trashEmptyCmd.Flags().StringVar(&largerThan, "larger-than", "", "only items larger than this (e.g. 1GB)")
+	trashEmptyCmd.Flags().BoolVar(&yesFlag, "yes", false, "confirm permanent deletion")
+
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+	rootCmd.AddCommand(trashCmd)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/undo"
+)
+
+var (
+	undoBatch     string
+	undoLast      bool
+	undoRename    bool
+	undoSkip      bool
+	undoOverwrite bool
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [id]",
+	Short: "Undo an operation or a batch of operations",
+	Long: `Undo an operation by its history ID, or every operation of a batch.
+
+Each organize --apply run, clean invocation and TUI session is one batch.
+Batches are undone in reverse order; operations that fail are reported at
+the end and the rest are still undone.
+
+Moved files are checked against the hash recorded when they were moved.
+If something now exists at the original path, choose --rename, --skip or
+--overwrite.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modes := len(args)
+		if undoBatch != "" {
+			modes++
+		}
+		if undoLast {
+			modes++
+		}
+		if modes != 1 {
+			return fmt.Errorf("give one of: an operation ID, --batch <id> or --last")
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		u, err := newUndoer(db)
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 0 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid operation ID: %s", args[0])
+			}
+
+			op, err := db.Get(id)
+			if err != nil {
+				return fmt.Errorf("operation not found: %d", id)
+			}
+
+			if err := undoOperation(u, op); err != nil {
+				return fmt.Errorf("operation %d: %w", id, err)
+			}
+			return nil
+		}
+
+		batchID := undoBatch
+		if undoLast {
+			if batchID, err = db.LastBatch(); err != nil {
+				return err
+			}
+			if batchID == "" {
+				return fmt.Errorf("no batch left to undo")
+			}
+		}
+
+		ops, err := db.Batch(batchID)
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			return fmt.Errorf("batch not found: %s", batchID)
+		}
+
+		var undone, skipped int
+		var failures []string
+		for i := len(ops) - 1; i >= 0; i-- {
+			op := ops[i]
+			if !op.Reversible {
+				continue
+			}
+			err := undoOperation(u, &op)
+			switch {
+			case errors.Is(err, undo.ErrSkipped):
+				fmt.Printf("Skipped %s: %v\n", op.SourcePath, err)
+				skipped++
+			case err != nil:
+				failures = append(failures, fmt.Sprintf("%d %s: %v", op.ID, op.SourcePath, err))
+			default:
+				undone++
+			}
+		}
+
+		fmt.Printf("Undid %d operations from batch %s", undone, batchID)
+		if skipped > 0 {
+			fmt.Printf(", skipped %d", skipped)
+		}
+		fmt.Println()
+		if len(failures) > 0 {
+			fmt.Fprintf(os.Stderr, "%d failed:\n", len(failures))
+			for _, f := range failures {
+				fmt.Fprintf(os.Stderr, "  %s\n", f)
+			}
+			return fmt.Errorf("%d operations could not be undone", len(failures))
+		}
+		return nil
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo <id>",
+	Short: "Apply an undone operation again",
+	Long: `Apply an undone operation again, given its history ID or the ID of the undo.
+
+The redo is recorded as a new operation that can itself be undone; see
+"breathe history --tree" for the chain. Conflicts at the target path are
+handled as for undo.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid operation ID: %s", args[0])
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		db, err := openHistory(config.DataPath())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		op, err := db.Get(id)
+		if err != nil {
+			return fmt.Errorf("operation not found: %d", id)
+		}
+
+		u, err := newUndoer(db)
+		if err != nil {
+			return err
+		}
+		if u.Quarantine, err = newQuarantine(cfg); err != nil {
+			return err
+		}
+
+		res, err := u.Redo(op)
+		if errors.Is(err, undo.ErrAlreadyRedone) {
+			return fmt.Errorf("operation %d: %w; see breathe history --tree", id, err)
+		}
+		if err != nil {
+			return fmt.Errorf("operation %d: %w", id, err)
+		}
+
+		fmt.Printf("Redid operation %d: %s is at %s (operation %d)\n", id, filepath.Base(res.Path), res.Path, res.ID)
+		if res.Displaced != "" {
+			fmt.Printf("  moved what was there to %s\n", res.Displaced)
+		}
+		return nil
+	},
+}
+
+// newUndoer applies the conflict flags to a new Undoer.
+func newUndoer(db *history.DB) (*undo.Undoer, error) {
+	mover := fsutil.NewMover()
+	mover.OnProgress = progressPrinter()
+	u := undo.New(db, mover)
+	u.Force = forceFlag
+	u.BatchID = history.NewBatchID()
+
+	switch {
+	case undoRename && (undoSkip || undoOverwrite), undoSkip && undoOverwrite:
+		return nil, fmt.Errorf("--rename, --skip and --overwrite can't be combined")
+	case undoRename:
+		u.OnConflict = undo.Rename
+	case undoSkip:
+		u.OnConflict = undo.Skip
+	case undoOverwrite:
+		u.OnConflict = undo.Overwrite
+	}
+	return u, nil
+}
+
+// undoOperation undoes op and reports what happened.
+func undoOperation(u *undo.Undoer, op *history.Operation) error {
+	res, err := u.Undo(op)
+	if err != nil {
+		return err
+	}
+
+	switch op.Type {
+	case history.OpMove:
+		fmt.Printf("Moved %s back to %s\n", op.DestPath, res.Path)
+	case history.OpTrash:
+		fmt.Printf("Restored %s from trash\n", res.Path)
+	case history.OpQuarantine:
+		fmt.Printf("Restored %s from quarantine\n", res.Path)
+	}
+	if res.Displaced != "" {
+		fmt.Printf("  moved the existing %s to %s\n", op.SourcePath, res.Displaced)
+	}
+	return nil
+}
+
+func init() {
+	undoCmd.Flags().StringVar(&undoBatch, "batch", "", "undo every operation of this batch")
+	undoCmd.Flags().BoolVar(&undoLast, "last", false, "undo the most recent batch")
+	undoCmd.Flags().BoolVar(&undoRename, "rename", false, "if the original path is taken, restore under a new name next to it")
+	undoCmd.Flags().BoolVar(&undoSkip, "skip", false, "if the original path is taken, leave the operation as it is")
+	undoCmd.Flags().BoolVar(&undoOverwrite, "overwrite", false, "if the original path is taken, move what is there to the trash")
+	undoCmd.Flags().BoolVar(&forceFlag, "force", false, "restore files even if they changed since the operation")
+	rootCmd.AddCommand(undoCmd)
+
+	redoCmd.Flags().BoolVar(&undoRename, "rename", false, "if the target path is taken, move under a new name next to it")
+	redoCmd.Flags().BoolVar(&undoSkip, "skip", false, "if the target path is taken, leave the operation undone")
+	redoCmd.Flags().BoolVar(&undoOverwrite, "overwrite", false, "if the target path is taken, move what is there to the trash")
+	redoCmd.Flags().BoolVar(&forceFlag, "force", false, "redo even if files changed since they were restored")
+	rootCmd.AddCommand(redoCmd)
+}
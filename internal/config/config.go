@@ -1,16 +1,21 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"gopkg.in/yaml.v3"
 )
 
 type JunkPattern struct {
-	Name    string `yaml:"name"`
-	Pattern string `yaml:"pattern"`
-	Safe    bool   `yaml:"safe"`
+	Name      string  `yaml:"name"`
+	Pattern   string  `yaml:"pattern"`
+	Safe      bool    `yaml:"safe"`
+	RegenCost float64 `yaml:"regen_cost,omitempty"` // Relative cost of regenerating deleted junk; 0 means 1
 }
 
 type OrganizeRule struct {
@@ -21,23 +26,51 @@ type OrganizeRule struct {
 type Deletion struct {
 	TrashThreshold string   `yaml:"trash_threshold"`
 	AlwaysTrash    []string `yaml:"always_trash"`
+	QuarantineTTL  string   `yaml:"quarantine_ttl"` // How long clean --quarantine keeps items, e.g. 7d
+	ShredPasses    int      `yaml:"shred_passes"`   // Overwrite passes for clean --shred
+}
+
+// History controls how the operation history is kept.
+type History struct {
+	Retention       string `yaml:"retention"`        // Prune operations older than this, e.g. 90d; empty keeps everything
+	PruneReversible bool   `yaml:"prune_reversible"` // Also prune old operations whose trash or quarantine item is still there
+	Required        bool   `yaml:"required"`         // Refuse to change files when their operations can't be recorded
+}
+
+// Safety limits where deletions may happen. Paths are globs; a leading ~ is
+// the home directory and a trailing /** protects everything below a directory.
+type Safety struct {
+	ProtectedPaths []string `yaml:"protected_paths"`
+	AllowedRoots   []string `yaml:"allowed_roots"` // Empty allows everything not protected
+	GitCheck       string   `yaml:"git_check"`     // Unsaved git work: "block" (default), "warn" or "off"
 }
 
 type Config struct {
 	JunkPatterns  []JunkPattern  `yaml:"junk_patterns"`
 	OrganizeRules []OrganizeRule `yaml:"organize_rules"`
 	Deletion      Deletion       `yaml:"deletion"`
+	Safety        Safety         `yaml:"safety"`
+	History       History        `yaml:"history"`
+}
+
+// DefaultProtectedPaths are used when the config doesn't set protected_paths.
+var DefaultProtectedPaths = []string{
+	"/", "/var", "/tmp", "/opt", "/home", "/root",
+	"/usr/**", "/etc/**", "/bin/**", "/sbin/**", "/lib/**", "/lib64/**", "/boot/**",
+	"/System/**", "/Library", "/Applications", // macOS
+	"/Windows/**", "/Program Files/**", // Windows
+	"~", "~/.ssh/**", "~/.gnupg/**",
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		JunkPatterns: []JunkPattern{
-			{Name: "node_modules", Pattern: "**/node_modules", Safe: true},
-			{Name: "JS build output", Pattern: "**/{dist,build,.next,.nuxt,out}/", Safe: true},
-			{Name: "C# build output", Pattern: "**/{bin,obj}/", Safe: true},
-			{Name: "Browser automation", Pattern: "**/{.chrome-data,chrome-data,puppeteer_data,.playwright}/", Safe: true},
-			{Name: "Package caches", Pattern: "**/{.npm/_cacache,.yarn/cache,.pnpm-store}/", Safe: true},
-			{Name: "Python cache", Pattern: "**/__pycache__/", Safe: true},
+			{Name: "node_modules", Pattern: "**/node_modules", Safe: true, RegenCost: 2},
+			{Name: "JS build output", Pattern: "**/{dist,build,.next,.nuxt,out}/", Safe: true, RegenCost: 2},
+			{Name: "C# build output", Pattern: "**/{bin,obj}/", Safe: true, RegenCost: 2},
+			{Name: "Browser automation", Pattern: "**/{.chrome-data,chrome-data,puppeteer_data,.playwright}", Safe: true},
+			{Name: "Package caches", Pattern: "**/{.npm/_cacache,.yarn/cache,.pnpm-store}", Safe: true, RegenCost: 3},
+			{Name: "Python cache", Pattern: "**/__pycache__", Safe: true},
 			{Name: "Git repos", Pattern: "**/.git", Safe: false},
 		},
 		OrganizeRules: []OrganizeRule{
@@ -55,11 +88,94 @@ func DefaultConfig() *Config {
 		Deletion: Deletion{
 			TrashThreshold: "1GB",
 			AlwaysTrash:    []string{".pdf", ".doc", ".xlsx"},
+			QuarantineTTL:  "7d",
+			ShredPasses:    3,
 		},
+		Safety: Safety{
+			ProtectedPaths: DefaultProtectedPaths,
+		},
+	}
+}
+
+// PatternError reports a junk pattern that cannot be parsed.
+type PatternError struct {
+	Name    string
+	Pattern string
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("junk pattern %q: invalid pattern %q", e.Name, e.Pattern)
+}
+
+// Validate checks every junk pattern and the deletion settings and returns
+// all problems joined together.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, p := range c.JunkPatterns {
+		if err := ValidatePattern(p); err != nil {
+			errs = append(errs, err)
+		}
+		if p.RegenCost < 0 {
+			errs = append(errs, fmt.Errorf("junk pattern %q: regen_cost must not be negative", p.Name))
+		}
+	}
+	for _, p := range c.Safety.ProtectedPaths {
+		if !filepath.IsAbs(ExpandHome(p)) || !doublestar.ValidatePathPattern(ExpandHome(p)) {
+			errs = append(errs, fmt.Errorf("safety.protected_paths: invalid path %q", p))
+		}
+	}
+	for _, p := range c.Safety.AllowedRoots {
+		if !filepath.IsAbs(ExpandHome(p)) {
+			errs = append(errs, fmt.Errorf("safety.allowed_roots: %q must be absolute", p))
+		}
+	}
+	switch c.Safety.GitCheck {
+	case "", "block", "warn", "off":
+	default:
+		errs = append(errs, fmt.Errorf("safety.git_check: %q must be block, warn or off", c.Safety.GitCheck))
+	}
+	if c.Deletion.TrashThreshold != "" {
+		if _, err := ParseSize(c.Deletion.TrashThreshold); err != nil {
+			errs = append(errs, fmt.Errorf("deletion.trash_threshold: %w", err))
+		}
 	}
+	if c.Deletion.ShredPasses < 0 {
+		errs = append(errs, fmt.Errorf("deletion.shred_passes: must not be negative"))
+	}
+	if c.Deletion.QuarantineTTL != "" {
+		if _, err := ParseAge(c.Deletion.QuarantineTTL); err != nil {
+			errs = append(errs, fmt.Errorf("deletion.quarantine_ttl: %w", err))
+		}
+	}
+	if c.History.Retention != "" {
+		if _, err := ParseAge(c.History.Retention); err != nil {
+			errs = append(errs, fmt.Errorf("history.retention: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func ValidatePattern(p JunkPattern) error {
+	if !doublestar.ValidatePathPattern(p.Pattern) {
+		return &PatternError{Name: p.Name, Pattern: p.Pattern}
+	}
+	return nil
 }
 
 func Load(path string) (*Config, error) {
+	cfg, err := LoadUnvalidated(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// LoadUnvalidated reads the config like Load but skips Validate, so tooling
+// can inspect a config that would otherwise fail to load.
+func LoadUnvalidated(path string) (*Config, error) {
 	if path == "" {
 		return DefaultConfig(), nil
 	}
@@ -77,9 +193,24 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// Never lose the default protection just because the section is missing;
+	// an explicit empty list still disables it.
+	if cfg.Safety.ProtectedPaths == nil {
+		cfg.Safety.ProtectedPaths = DefaultProtectedPaths
+	}
+
 	return cfg, nil
 }
 
+// ExpandHome replaces a leading ~ with the user's home directory.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, path[1:])
+}
+
 func DefaultPath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".config", "breathe", "config.yaml")
@@ -89,3 +220,9 @@ func DataPath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".local", "share", "breathe", "history.db")
 }
+
+// QuarantinePath is the quarantine for items on the home filesystem; other
+// filesystems get their own at the top of the mount.
+func QuarantinePath() string {
+	return filepath.Join(filepath.Dir(DataPath()), "quarantine")
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -134,3 +135,117 @@ func TestDataPath(t *testing.T) {
 		t.Errorf("DataPath() = %s, expected absolute path", path)
 	}
 }
+
+func TestLoad_InvalidPattern(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	yaml := `
+junk_patterns:
+  - name: "ok"
+    pattern: "**/ok"
+  - name: "broken"
+    pattern: "[broken"
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(cfgPath)
+	var perr *PatternError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected PatternError, got %v", err)
+	}
+	if perr.Name != "broken" {
+		t.Errorf("expected error for 'broken', got %s", perr.Name)
+	}
+
+	cfg, err := LoadUnvalidated(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadUnvalidated() error = %v", err)
+	}
+	if len(cfg.JunkPatterns) != 2 {
+		t.Errorf("expected 2 patterns, got %d", len(cfg.JunkPatterns))
+	}
+}
+
+func TestDefaultConfig_Validates(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("default config should validate: %v", err)
+	}
+}
+
+func TestLoad_InvalidTrashThreshold(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	yaml := `
+deletion:
+  trash_threshold: "one gigabyte"
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(cfgPath); err == nil {
+		t.Error("expected error for invalid trash threshold")
+	}
+}
+
+func TestLoad_InvalidHistoryRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	yaml := `
+history:
+  retention: "three months"
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(cfgPath); err == nil {
+		t.Error("expected error for invalid history retention")
+	}
+}
+
+func TestLoad_KeepsDefaultProtectedPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	yaml := `
+safety:
+  allowed_roots: ["~/projects"]
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Safety.ProtectedPaths) != len(DefaultProtectedPaths) {
+		t.Errorf("expected default protected paths, got %v", cfg.Safety.ProtectedPaths)
+	}
+	if len(cfg.Safety.AllowedRoots) != 1 {
+		t.Errorf("expected 1 allowed root, got %v", cfg.Safety.AllowedRoots)
+	}
+}
+
+func TestLoad_RelativeAllowedRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "config.yaml")
+
+	yaml := `
+safety:
+  allowed_roots: ["projects"]
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(cfgPath); err == nil {
+		t.Error("expected error for relative allowed root")
+	}
+}
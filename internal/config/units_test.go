@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":  1024,
+		"0":     0,
+		"10B":   10,
+		"1KB":   1024,
+		"1k":    1024,
+		"500MB": 500 << 20,
+		"1GB":   1 << 30,
+		"1.5GB": 3 << 29,
+		"2 GiB": 2 << 30,
+		"1TB":   1 << 40,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) error = %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSize(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestParseSize_Invalid(t *testing.T) {
+	for _, in := range []string{"", "GB", "1XB", "-1GB", "1.2.3MB", "lots"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) expected error", in)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+	for in, want := range tests {
+		got, err := ParseAge(in)
+		if err != nil {
+			t.Errorf("ParseAge(%q) error = %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseAge(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "d", "soon", "-1d"} {
+		if _, err := ParseAge(in); err == nil {
+			t.Errorf("ParseAge(%q) expected error", in)
+		}
+	}
+}
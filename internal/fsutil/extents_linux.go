@@ -0,0 +1,78 @@
+package fsutil
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Constants and layouts from linux/fiemap.h and linux/fs.h.
+const (
+	fsIocFiemap        = 0xC020660B // _IOWR('f', 11, struct fiemap)
+	fiemapFlagSync     = 0x1
+	fiemapExtentLast   = 0x1
+	fiemapExtentShared = 0x2000
+	fiemapBatch        = 32
+)
+
+type fiemapHeader struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	Reserved      uint32
+}
+
+type fiemapExtent struct {
+	Logical    uint64
+	Physical   uint64
+	Length     uint64
+	Reserved64 [2]uint64
+	Flags      uint32
+	Reserved   [3]uint32
+}
+
+type fiemapRequest struct {
+	fiemapHeader
+	Extents [fiemapBatch]fiemapExtent
+}
+
+// sharesExtents reports whether any extent of the file at path is shared with
+// another file, as reflinked copies on btrfs and XFS are. Filesystems without
+// FIEMAP return an error.
+func sharesExtents(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var start uint64
+	for {
+		req := fiemapRequest{fiemapHeader: fiemapHeader{
+			Start:       start,
+			Length:      ^uint64(0) - start,
+			Flags:       fiemapFlagSync,
+			ExtentCount: fiemapBatch,
+		}}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&req)))
+		if errno != 0 {
+			return false, errno
+		}
+		if req.MappedExtents == 0 {
+			return false, nil
+		}
+
+		for _, e := range req.Extents[:req.MappedExtents] {
+			if e.Flags&fiemapExtentShared != 0 {
+				return true, nil
+			}
+			if e.Flags&fiemapExtentLast != 0 {
+				return false, nil
+			}
+		}
+		last := req.Extents[req.MappedExtents-1]
+		start = last.Logical + last.Length
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fsutil
+
+import "errors"
+
+// sharesExtents can't tell shared storage apart on this platform.
+func sharesExtents(path string) (bool, error) {
+	return false, errors.ErrUnsupported
+}
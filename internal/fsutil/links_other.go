@@ -0,0 +1,7 @@
+//go:build !unix
+
+package fsutil
+
+import "io/fs"
+
+func linkCount(fs.FileInfo) uint64 { return 1 }
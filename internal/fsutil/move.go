@@ -0,0 +1,257 @@
+package fsutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Progress reports how far a cross-device copy has got.
+type Progress struct {
+	Path       string // File that was just copied
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// Mover moves files and directories, falling back to copy + verify + remove
+// when source and destination are on different filesystems.
+type Mover struct {
+	// OnProgress, if set, is called after each file copied by the fallback.
+	OnProgress func(Progress)
+
+	rename    func(oldpath, newpath string) error
+	removeAll func(path string) error
+}
+
+func NewMover() *Mover {
+	return &Mover{rename: os.Rename, removeAll: os.RemoveAll}
+}
+
+// PartialMoveError reports a cross-device move that copied src to Dst but
+// could not remove all of src. Dst is complete and verified.
+type PartialMoveError struct {
+	Dst string
+	Err error
+}
+
+func (e *PartialMoveError) Error() string {
+	return fmt.Sprintf("copied to %s but could not remove source: %v", e.Dst, e.Err)
+}
+
+func (e *PartialMoveError) Unwrap() error { return e.Err }
+
+// Move moves src to dst with a default Mover.
+func Move(src, dst string) error {
+	return NewMover().Move(src, dst)
+}
+
+// Move renames src to dst. If that fails because they are on different
+// filesystems, src is copied next to dst with its metadata, verified, renamed
+// into place and only then removed. A failed copy leaves dst untouched; if
+// removing src fails, the error is a *PartialMoveError.
+func (m *Mover) Move(src, dst string) error {
+	err := m.rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := m.copyAcross(src, dst); err != nil {
+		return err
+	}
+
+	if err := m.removeAll(src); err != nil {
+		return &PartialMoveError{Dst: dst, Err: err}
+	}
+	return nil
+}
+
+func (m *Mover) copyAcross(src, dst string) error {
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+
+	// Copy into a staging directory on the destination filesystem so dst only
+	// appears once the copy is complete and verified.
+	staging, err := os.MkdirTemp(filepath.Dir(dst), ".breathe-move-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	c := &copier{progress: m.OnProgress}
+	if err := c.count(src); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(staging, filepath.Base(dst))
+	if err := c.copy(src, tmp); err != nil {
+		return err
+	}
+	if err := c.verify(tmp); err != nil {
+		return err
+	}
+
+	return m.rename(tmp, dst)
+}
+
+type copier struct {
+	progress func(Progress)
+	state    Progress
+	hashes   map[string][]byte // Relative path -> sha256 of the source content
+	root     string
+}
+
+func (c *copier) count(src string) error {
+	return filepath.WalkDir(src, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			c.state.FilesTotal++
+			c.state.BytesTotal += info.Size()
+		}
+		return nil
+	})
+}
+
+func (c *copier) copy(src, dst string) error {
+	c.root = dst
+	c.hashes = make(map[string][]byte)
+
+	var dirs []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+			// Directory permissions and times are applied after their contents
+			dirs = append(dirs, path)
+			return nil
+		case mode&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			chown(target, info)
+			return nil
+		case mode.IsRegular():
+			if err := c.copyFile(path, target, rel, info); err != nil {
+				return err
+			}
+			return applyMetadata(target, info)
+		default:
+			return fmt.Errorf("cannot copy special file %s", path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Lstat(dirs[i])
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, dirs[i])
+		if err := applyMetadata(filepath.Join(dst, rel), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *copier) copyFile(src, dst, rel string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(out, io.TeeReader(in, h))
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n != info.Size() {
+		return fmt.Errorf("short copy of %s: %d of %d bytes", src, n, info.Size())
+	}
+
+	c.hashes[rel] = h.Sum(nil)
+	c.state.Path = src
+	c.state.FilesDone++
+	c.state.BytesDone += n
+	if c.progress != nil {
+		c.progress(c.state)
+	}
+	return nil
+}
+
+// verify re-reads every copied file and compares it with the source hash.
+func (c *copier) verify(dst string) error {
+	for rel, want := range c.hashes {
+		f, err := os.Open(filepath.Join(dst, rel))
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(h.Sum(nil), want) {
+			return fmt.Errorf("verification failed for %s: copy differs from source", rel)
+		}
+	}
+	return nil
+}
+
+func applyMetadata(path string, info fs.FileInfo) error {
+	chown(path, info)
+	if err := os.Chmod(path, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
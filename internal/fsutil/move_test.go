@@ -0,0 +1,150 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// crossDeviceMover simulates src and dst living on different filesystems:
+// renames out of srcRoot fail with EXDEV, everything else is a real rename.
+func crossDeviceMover(srcRoot string) *Mover {
+	return &Mover{rename: func(oldpath, newpath string) error {
+		if strings.HasPrefix(oldpath, srcRoot) {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return os.Rename(oldpath, newpath)
+	}, removeAll: os.RemoveAll}
+}
+
+func TestMove_SameDevice(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "a.txt")
+	dst := filepath.Join(tmpDir, "b.txt")
+	os.WriteFile(src, []byte("hello"), 0644)
+
+	if err := Move(src, dst); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "hello" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
+
+func TestMove_CrossDeviceDirectory(t *testing.T) {
+	srcRoot := t.TempDir()
+	dstRoot := t.TempDir()
+
+	src := filepath.Join(srcRoot, "project")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0640)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("bbbbb"), 0600)
+	os.Symlink("a.txt", filepath.Join(src, "link"))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime)
+
+	m := crossDeviceMover(srcRoot)
+	var last Progress
+	m.OnProgress = func(p Progress) { last = p }
+
+	dst := filepath.Join(dstRoot, "project")
+	if err := m.Move(src, dst); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source should be removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "sub", "b.txt")); string(data) != "bbbbb" {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "a.txt" {
+		t.Errorf("symlink not preserved: %q, %v", link, err)
+	}
+
+	if last.FilesDone != 2 || last.FilesTotal != 2 || last.BytesDone != 8 || last.BytesTotal != 8 {
+		t.Errorf("unexpected final progress %+v", last)
+	}
+
+	// The staging directory must not be left behind
+	entries, _ := os.ReadDir(dstRoot)
+	if len(entries) != 1 {
+		t.Errorf("expected only the moved directory in destination, got %d entries", len(entries))
+	}
+}
+
+func TestMove_CrossDeviceFailureLeavesNoTrace(t *testing.T) {
+	srcRoot := t.TempDir()
+	dstRoot := t.TempDir()
+
+	src := filepath.Join(srcRoot, "project")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0644)
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0644); err != nil {
+		t.Skipf("mkfifo not supported: %v", err)
+	}
+
+	dst := filepath.Join(dstRoot, "project")
+	err := crossDeviceMover(srcRoot).Move(src, dst)
+	if err == nil {
+		t.Fatal("expected error copying special file")
+	}
+
+	if _, err := os.Stat(filepath.Join(src, "a.txt")); err != nil {
+		t.Error("source should be untouched after a failed move")
+	}
+	entries, _ := os.ReadDir(dstRoot)
+	if len(entries) != 0 {
+		t.Errorf("expected empty destination after failed move, got %d entries", len(entries))
+	}
+}
+
+func TestMove_CrossDeviceRemoveFailureIsPartial(t *testing.T) {
+	srcRoot := t.TempDir()
+	dstRoot := t.TempDir()
+
+	src := filepath.Join(srcRoot, "a.txt")
+	os.WriteFile(src, []byte("aaa"), 0644)
+	dst := filepath.Join(dstRoot, "a.txt")
+
+	m := crossDeviceMover(srcRoot)
+	m.removeAll = func(string) error { return os.ErrPermission }
+	err := m.Move(src, dst)
+
+	var partial *PartialMoveError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected *PartialMoveError, got %v", err)
+	}
+	if partial.Dst != dst || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("unexpected partial move error %+v", partial)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "aaa" {
+		t.Errorf("destination should hold the copy, got %q", data)
+	}
+}
+
+func TestMove_OtherErrorsAreReturned(t *testing.T) {
+	tmpDir := t.TempDir()
+	err := Move(filepath.Join(tmpDir, "missing"), filepath.Join(tmpDir, "dst"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not-exist error, got %v", err)
+	}
+}
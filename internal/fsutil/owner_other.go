@@ -0,0 +1,7 @@
+//go:build !unix
+
+package fsutil
+
+import "io/fs"
+
+func chown(string, fs.FileInfo) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chown copies ownership from info where permitted. Unprivileged users can't
+// give files away, so failures are ignored and the copy keeps the caller as owner.
+func chown(path string, info fs.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		os.Lchown(path, int(st.Uid), int(st.Gid))
+	}
+}
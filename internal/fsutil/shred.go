@@ -0,0 +1,121 @@
+package fsutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ShredFile is a regular file found by Inventory, hashed before shredding so
+// the audit trail can prove what was destroyed.
+type ShredFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Skipped string `json:"skipped,omitempty"` // Why the contents won't be overwritten
+}
+
+// Inventory hashes every regular file at or under path. Files whose contents
+// are shared with other names, through hard links or reflinks, are marked
+// Skipped: overwriting them would destroy data that outlives this deletion.
+func Inventory(path string) ([]ShredFile, error) {
+	var files []ShredFile
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		f := ShredFile{Path: p, Size: info.Size()}
+		if f.SHA256, err = HashFile(p); err != nil {
+			return err
+		}
+		if n := linkCount(info); n > 1 {
+			f.Skipped = fmt.Sprintf("hard linked (%d names)", n)
+		} else if shared, err := sharesExtents(p); err == nil && shared {
+			f.Skipped = "shares storage with another file (reflink or clone)"
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// Shred overwrites every file in files that isn't Skipped with passes of
+// random data, syncing after each pass, and then removes path.
+func Shred(path string, files []ShredFile, passes int) error {
+	for _, f := range files {
+		if f.Skipped != "" {
+			continue
+		}
+		if err := overwrite(f.Path, f.Size, passes); err != nil {
+			return fmt.Errorf("overwrite %s: %w", f.Path, err)
+		}
+	}
+	return os.RemoveAll(path)
+}
+
+// ManifestHash summarizes an inventory as the SHA-256 of a sha256sum-style
+// listing with paths relative to root, so a directory gets one audit hash.
+func ManifestHash(root string, files []ShredFile) string {
+	lines := make([]string, 0, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Path)
+		if err != nil {
+			rel = f.Path
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", f.SHA256, filepath.ToSlash(rel)))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func overwrite(path string, size int64, passes int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for i := 0; i < passes; i++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(f, rand.Reader, size); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// HashFile returns the hex SHA-256 of a file's contents.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,80 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShred_OverwritesAndSkipsHardLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "export")
+	os.MkdirAll(dir, 0755)
+
+	secret := filepath.Join(dir, "secret.csv")
+	original := []byte("customer,card\nalice,4111111111111111\n")
+	os.WriteFile(secret, original, 0600)
+
+	keep := filepath.Join(tmpDir, "keep.txt")
+	os.WriteFile(keep, []byte("still needed"), 0644)
+	if err := os.Link(keep, filepath.Join(dir, "linked.txt")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	files, err := Inventory(dir)
+	if err != nil {
+		t.Fatalf("Inventory() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %+v", files)
+	}
+	for _, f := range files {
+		switch filepath.Base(f.Path) {
+		case "secret.csv":
+			if f.Skipped != "" || f.SHA256 == "" {
+				t.Errorf("secret.csv should be hashed and overwritten, got %+v", f)
+			}
+		case "linked.txt":
+			if f.Skipped == "" {
+				t.Error("hard linked file should be skipped")
+			}
+		}
+	}
+
+	// Keep the inode open to see what happened to its contents
+	fd, err := os.Open(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	if err := Shred(dir, files, 2); err != nil {
+		t.Fatalf("Shred() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("directory should be removed")
+	}
+
+	after, _ := io.ReadAll(fd)
+	if len(after) != len(original) || bytes.Equal(after, original) {
+		t.Error("secret contents should have been overwritten in place")
+	}
+	if data, _ := os.ReadFile(keep); string(data) != "still needed" {
+		t.Errorf("hard linked file was modified: %q", data)
+	}
+}
+
+func TestManifestHash_IndependentOfOrder(t *testing.T) {
+	a := []ShredFile{{Path: "/r/a", SHA256: "11"}, {Path: "/r/b", SHA256: "22"}}
+	b := []ShredFile{a[1], a[0]}
+	if ManifestHash("/r", a) != ManifestHash("/r", b) {
+		t.Error("manifest hash should not depend on walk order")
+	}
+	if ManifestHash("/r", a) == ManifestHash("/other", a) {
+		t.Error("manifest hash should use paths relative to root")
+	}
+}
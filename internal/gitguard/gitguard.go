@@ -0,0 +1,300 @@
+// Package gitguard detects git repositories with work that would be lost by
+// deleting a directory: uncommitted or untracked files, stashes, and branches
+// that were never pushed. Everything is read locally; nothing is fetched.
+package gitguard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Report describes unsaved work in one repository.
+type Report struct {
+	Repo          string   `json:"repo"`
+	Modified      int      `json:"modified"`
+	Untracked     int      `json:"untracked"`
+	Stashes       int      `json:"stashes"`
+	LocalBranches []string `json:"local_branches,omitempty"` // No remote counterpart
+	AheadBranches []string `json:"ahead_branches,omitempty"` // Commits not pushed to upstream
+	StatusUnknown string   `json:"status_unknown,omitempty"` // Why the working tree couldn't be checked
+}
+
+// Dirty reports whether deleting the repository would lose anything.
+func (r Report) Dirty() bool {
+	return r.Modified > 0 || r.Untracked > 0 || r.Stashes > 0 ||
+		len(r.LocalBranches) > 0 || len(r.AheadBranches) > 0 || r.StatusUnknown != ""
+}
+
+// Reasons returns a short description of each kind of unsaved work.
+func (r Report) Reasons() []string {
+	var reasons []string
+	if r.Modified > 0 {
+		reasons = append(reasons, plural(r.Modified, "modified file"))
+	}
+	if r.Untracked > 0 {
+		reasons = append(reasons, plural(r.Untracked, "untracked file"))
+	}
+	if r.Stashes > 0 {
+		reasons = append(reasons, plural(r.Stashes, "stash"))
+	}
+	if len(r.LocalBranches) > 0 {
+		reasons = append(reasons, "local-only branches: "+strings.Join(r.LocalBranches, ", "))
+	}
+	if len(r.AheadBranches) > 0 {
+		reasons = append(reasons, "unpushed commits on: "+strings.Join(r.AheadBranches, ", "))
+	}
+	if r.StatusUnknown != "" {
+		reasons = append(reasons, r.StatusUnknown)
+	}
+	return reasons
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%s has %s", r.Repo, strings.Join(r.Reasons(), "; "))
+}
+
+// Check inspects every repository under target, the repository whose .git
+// target is, and the repository that contains target. It returns reports for
+// the dirty ones only.
+func Check(target string) ([]Report, error) {
+	target = filepath.Clean(target)
+
+	var reports []Report
+	add := func(r Report) {
+		if r.Dirty() {
+			reports = append(reports, r)
+		}
+	}
+
+	// Deleting a .git directory loses everything that isn't in the worktree
+	if filepath.Base(target) == ".git" {
+		add(inspect(filepath.Dir(target), ""))
+		return reports, nil
+	}
+
+	// Deleting part of a repository loses changes to files in that part
+	if outer := enclosingWorktree(target); outer != "" {
+		rel, err := filepath.Rel(outer, target)
+		if err == nil {
+			add(inspect(outer, rel))
+		}
+	}
+
+	err := filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable directories can't be checked either way
+		}
+		if d.Name() != ".git" {
+			return nil
+		}
+		add(inspect(filepath.Dir(path), ""))
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return reports, err
+}
+
+// enclosingWorktree returns the worktree strictly above path, or "".
+func enclosingWorktree(path string) string {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// inspect checks one worktree. With a pathspec only the working tree status of
+// that part is checked, since stashes and branches survive deleting it.
+func inspect(worktree, pathspec string) Report {
+	r := Report{Repo: worktree}
+
+	r.Modified, r.Untracked, r.StatusUnknown = status(worktree, pathspec)
+	if pathspec != "" {
+		return r
+	}
+
+	gitDir, commonDir := gitDirs(worktree)
+	if gitDir == "" {
+		return r
+	}
+	r.Stashes = countStashes(commonDir)
+	r.LocalBranches = localOnlyBranches(commonDir)
+	r.AheadBranches = aheadBranches(worktree)
+	return r
+}
+
+// status counts modified and untracked files with git itself, which is the
+// only reliable reader of the index.
+func status(worktree, pathspec string) (modified, untracked int, unknown string) {
+	args := []string{"-C", worktree, "status", "--porcelain=v1", "-z", "--untracked-files=all"}
+	if pathspec != "" {
+		args = append(args, "--", pathspec)
+	}
+	out, err := git(args...)
+	if err != nil {
+		return 0, 0, fmt.Sprintf("cannot check for uncommitted changes: %v", err)
+	}
+
+	// Entries are "XY path"; renames and copies are followed by a separate
+	// field with the original path
+	entries := bytes.Split(out, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue // Empty tail
+		}
+		x, y := entry[0], entry[1]
+		if x == '?' && y == '?' {
+			untracked++
+		} else {
+			modified++
+		}
+		if x == 'R' || x == 'C' || y == 'R' || y == 'C' {
+			i++
+		}
+	}
+	return modified, untracked, ""
+}
+
+func aheadBranches(worktree string) []string {
+	out, err := git("-C", worktree, "for-each-ref", "--format=%(refname:short)\t%(upstream:track)", "refs/heads")
+	if err != nil {
+		return nil
+	}
+	var ahead []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name, track, ok := strings.Cut(line, "\t")
+		if ok && strings.Contains(track, "ahead") {
+			ahead = append(ahead, name)
+		}
+	}
+	return ahead
+}
+
+func git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	// Don't refresh the index or take locks in repositories we only inspect
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		msg, _, _ := strings.Cut(strings.TrimSpace(string(exitErr.Stderr)), "\n")
+		return nil, fmt.Errorf("git: %s", msg)
+	}
+	return out, err
+}
+
+// gitDirs resolves the git directory of a worktree, following "gitdir:" files
+// used by linked worktrees and submodules, and its common directory.
+func gitDirs(worktree string) (gitDir, commonDir string) {
+	gitDir = filepath.Join(worktree, ".git")
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", ""
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", ""
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+		if !ok {
+			return "", ""
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(worktree, target)
+		}
+		gitDir = target
+	}
+
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+	return gitDir, commonDir
+}
+
+func countStashes(commonDir string) int {
+	data, err := os.ReadFile(filepath.Join(commonDir, "logs", "refs", "stash"))
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+// localOnlyBranches returns branches without a remote-tracking ref of the
+// same name on any remote.
+func localOnlyBranches(commonDir string) []string {
+	refs := readRefs(commonDir)
+
+	remote := make(map[string]bool)
+	for ref := range refs {
+		if rest, ok := strings.CutPrefix(ref, "refs/remotes/"); ok {
+			if _, name, ok := strings.Cut(rest, "/"); ok {
+				remote[name] = true
+			}
+		}
+	}
+
+	var local []string
+	for ref := range refs {
+		if name, ok := strings.CutPrefix(ref, "refs/heads/"); ok && !remote[name] {
+			local = append(local, name)
+		}
+	}
+	sort.Strings(local)
+	return local
+}
+
+// readRefs collects loose and packed ref names.
+func readRefs(commonDir string) map[string]bool {
+	refs := make(map[string]bool)
+
+	refsDir := filepath.Join(commonDir, "refs")
+	filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(commonDir, path)
+			refs[filepath.ToSlash(rel)] = true
+		}
+		return nil
+	})
+
+	f, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "#") && !strings.HasPrefix(fields[0], "^") {
+			refs[fields[1]] = true
+		}
+	}
+	return refs
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "sh") {
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,169 @@
+package gitguard
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// clonedRepo returns a clean clone of a bare repository with one pushed commit.
+func clonedRepo(t *testing.T) (root, repo string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root = t.TempDir()
+	bare := filepath.Join(root, "origin.git")
+	run(t, root, "init", "-q", "--bare", "-b", "main", bare)
+
+	repo = filepath.Join(root, "work", "repo")
+	os.MkdirAll(filepath.Dir(repo), 0755)
+	run(t, root, "clone", "-q", bare, repo)
+	run(t, repo, "checkout", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(repo, "README"), []byte("hello\n"), 0644)
+	os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("build/\n"), 0644)
+	run(t, repo, "add", ".")
+	run(t, repo, "commit", "-q", "-m", "init")
+	run(t, repo, "push", "-q", "-u", "origin", "main")
+	return root, repo
+}
+
+func TestCheck_CleanRepo(t *testing.T) {
+	root, _ := clonedRepo(t)
+
+	reports, err := Check(filepath.Join(root, "work"))
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("expected clean repo, got %v", reports)
+	}
+}
+
+func TestCheck_ModifiedAndUntracked(t *testing.T) {
+	root, repo := clonedRepo(t)
+	os.WriteFile(filepath.Join(repo, "README"), []byte("changed\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("new\n"), 0644)
+
+	reports, err := Check(filepath.Join(root, "work"))
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected 1 dirty repo, got %v", reports)
+	}
+	r := reports[0]
+	if r.Repo != repo || r.Modified != 1 || r.Untracked != 1 {
+		t.Errorf("unexpected report %+v", r)
+	}
+}
+
+func TestCheck_RenameCountedOnce(t *testing.T) {
+	root, repo := clonedRepo(t)
+	run(t, repo, "mv", "README", "README.md")
+
+	reports, err := Check(filepath.Join(root, "work"))
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected 1 dirty repo, got %v", reports)
+	}
+	if r := reports[0]; r.Modified != 1 || r.Untracked != 0 {
+		t.Errorf("expected the rename counted once, got %+v", r)
+	}
+}
+
+func TestCheck_StashAndLocalBranch(t *testing.T) {
+	_, repo := clonedRepo(t)
+
+	os.WriteFile(filepath.Join(repo, "README"), []byte("wip\n"), 0644)
+	run(t, repo, "stash", "-q")
+	run(t, repo, "branch", "experiment")
+
+	reports, err := Check(repo)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected 1 dirty repo, got %v", reports)
+	}
+	r := reports[0]
+	if r.Stashes != 1 {
+		t.Errorf("expected 1 stash, got %d", r.Stashes)
+	}
+	if len(r.LocalBranches) != 1 || r.LocalBranches[0] != "experiment" {
+		t.Errorf("expected local-only branch experiment, got %v", r.LocalBranches)
+	}
+}
+
+func TestCheck_UnpushedCommits(t *testing.T) {
+	_, repo := clonedRepo(t)
+
+	os.WriteFile(filepath.Join(repo, "README"), []byte("more\n"), 0644)
+	run(t, repo, "commit", "-q", "-am", "local")
+
+	reports, err := Check(filepath.Join(repo, ".git"))
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 1 || len(reports[0].AheadBranches) != 1 {
+		t.Fatalf("expected main to be ahead, got %v", reports)
+	}
+}
+
+func TestCheck_InsideRepo(t *testing.T) {
+	_, repo := clonedRepo(t)
+
+	// Ignored build output is safe to delete
+	build := filepath.Join(repo, "build")
+	os.MkdirAll(build, 0755)
+	os.WriteFile(filepath.Join(build, "out.o"), []byte("obj"), 0644)
+
+	reports, err := Check(build)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("ignored directory should be safe, got %v", reports)
+	}
+
+	// Untracked source is not
+	src := filepath.Join(repo, "src")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("package main"), 0644)
+
+	reports, err = Check(src)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(reports) != 1 || reports[0].Untracked != 1 {
+		t.Errorf("expected untracked file in src, got %v", reports)
+	}
+}
+
+func TestReport_Reasons(t *testing.T) {
+	r := Report{Repo: "/r", Modified: 2, Stashes: 1, LocalBranches: []string{"a"}}
+	got := r.String()
+	for _, want := range []string{"2 modified files", "1 stash", "local-only branches: a"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package history
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Each operation is sealed into a hash chain once its outcome is final: its
+// digest covers what was done and the digest of the operation sealed before
+// it, so editing, inserting or removing a sealed record breaks the chain from
+// that point on. State and reversibility are not covered, since later undos,
+// redos and pruning change them. Prune keeps the digests of the operations it
+// deletes, so the chain still verifies, and seals a record listing them, so a
+// digest copied there by hand shows up as a deletion nobody recorded.
+
+// unsealedKeys are metadata annotations added after an operation is sealed.
+var unsealedKeys = map[string]bool{"orphaned": true}
+
+// digest returns the chain digest of op following prev.
+func digest(op Operation, prev string) string {
+	metadata := make(map[string]string)
+	for k, v := range op.Metadata {
+		if !unsealedKeys[k] {
+			metadata[k] = v
+		}
+	}
+	content, _ := json.Marshal(struct {
+		ID         int64
+		Timestamp  string
+		Type       OpType
+		SourcePath string
+		DestPath   string
+		FileSize   int64
+		FileHash   string
+		Metadata   map[string]string
+		BatchID    string
+		InverseOf  int64
+	}{op.ID, formatTimestamp(op.Timestamp), op.Type, op.SourcePath, op.DestPath, op.FileSize, op.FileHash,
+		metadata, op.BatchID, op.InverseOf})
+
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chainHead returns the sequence number and digest of the last sealed
+// operation, which may have been pruned since.
+func chainHead(tx *sql.Tx) (int64, string, error) {
+	var seq int64
+	var head string
+	for _, table := range []string{"operations", "pruned_digests"} {
+		var s sql.NullInt64
+		var d sql.NullString
+		err := tx.QueryRow(`SELECT seal_seq, digest FROM `+table+` WHERE seal_seq IS NOT NULL ORDER BY seal_seq DESC LIMIT 1`).Scan(&s, &d)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		if s.Int64 > seq {
+			seq, head = s.Int64, d.String
+		}
+	}
+	return seq, head, nil
+}
+
+// seal appends the operation with the given ID to the chain. Call it in the
+// transaction that makes the operation's outcome final.
+func seal(tx *sql.Tx, id int64) error {
+	rows, err := tx.Query(`SELECT `+opColumns+` FROM operations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	ops, err := scanOperations(rows)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return fmt.Errorf("operation %d not found", id)
+	}
+
+	seq, head, err := chainHead(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE operations SET seal_seq = ?, digest = ? WHERE id = ?`, seq+1, digest(ops[0], head), id)
+	return err
+}
+
+// sealAll seals every finished operation that isn't sealed yet, oldest
+// first. Migration 5 uses it to seal the history that predates the chain.
+func sealAll(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id FROM operations WHERE digest IS NULL AND state != 'pending' ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := seal(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordPrune seals an OpPrune listing the chain positions in seqs.
+func recordPrune(tx *sql.Tx, seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	id, err := insert(tx, Operation{
+		Type: OpPrune,
+		Metadata: map[string]string{
+			"count":  strconv.Itoa(len(seqs)),
+			"pruned": formatSeqs(seqs),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return seal(tx, id)
+}
+
+// recordPrunedBefore seals a prune record for the digests pruned before
+// prunes were recorded. Migration 7 uses it.
+func recordPrunedBefore(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT seal_seq FROM pruned_digests ORDER BY seal_seq`)
+	if err != nil {
+		return err
+	}
+	var seqs []int64
+	for rows.Next() {
+		var seq int64
+		if err := rows.Scan(&seq); err != nil {
+			rows.Close()
+			return err
+		}
+		seqs = append(seqs, seq)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return recordPrune(tx, seqs)
+}
+
+// formatSeqs writes ascending chain positions as ranges, such as "1-5,7".
+func formatSeqs(seqs []int64) string {
+	var b strings.Builder
+	for i := 0; i < len(seqs); {
+		j := i
+		for j+1 < len(seqs) && seqs[j+1] == seqs[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatInt(seqs[i], 10))
+		if j > i {
+			fmt.Fprintf(&b, "-%d", seqs[j])
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// parseSeqs calls fn for each chain position up to limit in ranges written by
+// formatSeqs, skipping anything it can't read.
+func parseSeqs(ranges string, limit int64, fn func(seq int64)) {
+	for _, r := range strings.Split(ranges, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			continue
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseInt(hi, 10, 64); err != nil {
+				continue
+			}
+		}
+		for seq := first; seq <= min(last, limit); seq++ {
+			fn(seq)
+		}
+	}
+}
+
+// VerifyResult reports the state of the hash chain.
+type VerifyResult struct {
+	Sealed int    `json:"sealed"`         // Operations in the chain, including pruned ones
+	Head   string `json:"head,omitempty"` // Digest of the last sealed operation
+	Broken *Break `json:"broken,omitempty"`
+}
+
+// Break describes the first point where the chain doesn't verify.
+type Break struct {
+	Seq    int64  `json:"seq"` // Position in the chain
+	ID     int64  `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (b *Break) String() string {
+	if b.ID != 0 {
+		return fmt.Sprintf("chain broken at #%d (operation %d): %s", b.Seq, b.ID, b.Reason)
+	}
+	return fmt.Sprintf("chain broken at #%d: %s", b.Seq, b.Reason)
+}
+
+// Verify recomputes the hash chain and reports the first broken link. A
+// pruned operation only verifies if a prune record sealed after it lists it.
+// Removing the newest operations, or recording a prune by hand, leaves a chain
+// that still verifies; compare Head with a copy kept elsewhere to detect that.
+func (d *DB) Verify() (*VerifyResult, error) {
+	type link struct {
+		id     int64
+		digest string
+	}
+	links := make(map[int64]link)
+	unsealed := make(map[int64]bool)
+	rows, err := d.db.Query(`SELECT id, seal_seq, digest, state FROM operations`)
+	if err != nil {
+		return nil, err
+	}
+	var last int64
+	for rows.Next() {
+		var id int64
+		var seq sql.NullInt64
+		var dig sql.NullString
+		var state State
+		if err := rows.Scan(&id, &seq, &dig, &state); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !seq.Valid || !dig.Valid {
+			if state != StatePending {
+				unsealed[id] = true
+			}
+			continue
+		}
+		links[seq.Int64] = link{id, dig.String}
+		last = max(last, seq.Int64)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pruned := make(map[int64]string)
+	rows, err = d.db.Query(`SELECT seal_seq, digest FROM pruned_digests`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var seq int64
+		var dig string
+		if err := rows.Scan(&seq, &dig); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pruned[seq] = dig
+		last = max(last, seq)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	all, err := d.db.Query(`SELECT ` + opColumns + ` FROM operations WHERE digest IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := scanOperations(all)
+	all.Close()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]Operation, len(ops))
+	for _, op := range ops {
+		byID[op.ID] = op
+	}
+
+	// Chain positions listed by prune records sealed after them
+	recorded := make(map[int64]bool)
+	for seq, l := range links {
+		if op := byID[l.id]; op.Type == OpPrune {
+			parseSeqs(op.Metadata["pruned"], seq-1, func(s int64) { recorded[s] = true })
+		}
+	}
+
+	res := &VerifyResult{}
+	prev := ""
+	for seq := int64(1); seq <= last; seq++ {
+		l, ok := links[seq]
+		if !ok {
+			dig, ok := pruned[seq]
+			if !ok {
+				res.Broken = &Break{Seq: seq, Reason: "sealed operation is missing"}
+				return res, nil
+			}
+			if !recorded[seq] {
+				res.Broken = &Break{Seq: seq, Reason: "sealed operation was removed without a prune record"}
+				return res, nil
+			}
+			prev = dig
+			res.Sealed++
+			continue
+		}
+
+		if digest(byID[l.id], prev) != l.digest {
+			res.Broken = &Break{Seq: seq, ID: l.id, Reason: "contents or order changed since it was sealed"}
+			return res, nil
+		}
+		prev = l.digest
+		res.Sealed++
+	}
+	res.Head = prev
+
+	for id := range unsealed {
+		if res.Broken == nil || id < res.Broken.ID {
+			res.Broken = &Break{Seq: last + 1, ID: id, Reason: "finished operation was never sealed"}
+		}
+	}
+	return res, nil
+}
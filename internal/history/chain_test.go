@@ -0,0 +1,97 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDB_Verify(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	verify := func() *VerifyResult {
+		t.Helper()
+		res, err := db.Verify()
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		return res
+	}
+
+	db.Record(Operation{Type: OpDelete, SourcePath: "/old", Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	moved, _ := db.Record(Operation{Type: OpMove, SourcePath: "/a", DestPath: "/b", Reversible: true})
+	db.RecordUndo(moved, Operation{SourcePath: "/b", DestPath: "/a"})
+	pending, _ := db.Begin(Operation{Type: OpTrash, SourcePath: "/c"})
+
+	res := verify()
+	if res.Broken != nil || res.Sealed != 3 || res.Head == "" {
+		t.Fatalf("expected 3 sealed operations and the pending one left out, got %+v", res)
+	}
+
+	// Finishing, annotating and pruning operations keeps the chain intact
+	db.Fail(pending, errors.New("gone"))
+	db.db.Exec(`UPDATE operations SET metadata = json_set('{}', '$.orphaned', 'now') WHERE id = ?`, moved)
+	if _, err := db.Prune(PruneOptions{Before: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	// The prune record is sealed too
+	if res := verify(); res.Broken != nil || res.Sealed != 5 {
+		t.Fatalf("expected 5 sealed operations after pruning, got %+v", res)
+	}
+
+	// Editing a sealed operation breaks the chain there
+	db.db.Exec(`UPDATE operations SET source_path = '/elsewhere' WHERE id = ?`, moved)
+	if res := verify(); res.Broken == nil || res.Broken.ID != moved {
+		t.Errorf("expected the edited operation %d reported, got %+v", moved, res.Broken)
+	}
+	db.db.Exec(`UPDATE operations SET source_path = '/a' WHERE id = ?`, moved)
+
+	// So does removing one outside Prune, even with its digest kept as
+	// Prune would
+	db.db.Exec(`INSERT INTO pruned_digests SELECT seal_seq, digest FROM operations WHERE id = ?`, moved)
+	db.db.Exec(`DELETE FROM operations WHERE id = ?`, moved)
+	if res := verify(); res.Broken == nil || res.Broken.Seq != 2 || res.Broken.ID != 0 {
+		t.Errorf("expected the missing operation at #2 reported, got %+v", res.Broken)
+	}
+	db.db.Exec(`DELETE FROM pruned_digests WHERE seal_seq = 2`)
+	if res := verify(); res.Broken == nil || res.Broken.Seq != 2 {
+		t.Errorf("expected the missing operation at #2 reported, got %+v", res.Broken)
+	}
+}
+
+func TestFormatSeqs(t *testing.T) {
+	seqs := []int64{1, 2, 3, 5, 7, 8}
+	ranges := formatSeqs(seqs)
+	if ranges != "1-3,5,7-8" {
+		t.Errorf("formatSeqs() = %q", ranges)
+	}
+	var got []int64
+	parseSeqs(ranges, 7, func(s int64) { got = append(got, s) })
+	if !reflect.DeepEqual(got, []int64{1, 2, 3, 5, 7}) {
+		t.Errorf("parseSeqs() up to 7 = %v", got)
+	}
+}
+
+func TestDB_VerifyReportsUnsealedOperations(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	db.Record(Operation{Type: OpDelete, SourcePath: "/a"})
+	db.db.Exec(`INSERT INTO operations (operation, source_path) VALUES ('delete', '/forged')`)
+	res, err := db.Verify()
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if res.Broken == nil || res.Broken.ID != 2 {
+		t.Errorf("expected the unsealed operation reported, got %+v", res.Broken)
+	}
+}
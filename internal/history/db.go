@@ -1,11 +1,16 @@
 package history
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -14,9 +19,50 @@ import (
 type OpType string
 
 const (
-	OpMove   OpType = "move"
-	OpDelete OpType = "delete"
-	OpTrash  OpType = "trash"
+	OpMove    OpType = "move"
+	OpDelete  OpType = "delete"
+	OpTrash   OpType = "trash"
+	OpRestore OpType = "restore" // Trashed item moved back to its original path; InverseOf names the trash
+	OpPurge   OpType = "purge"   // Trashed or quarantined item permanently removed; InverseOf names how it got there
+
+	// OpQuarantine moves an item into breathe's quarantine; its expires_at
+	// metadata (RFC 3339) says when quarantine purge may delete it.
+	OpQuarantine OpType = "quarantine"
+
+	// OpShred overwrites and removes an item. FileHash is the SHA-256 of the
+	// file, or of a directory's manifest, which is kept in metadata with the
+	// number of passes.
+	OpShred OpType = "shred"
+
+	// OpUndo reverts the operation named by InverseOf, moving SourcePath back
+	// to DestPath. Redoing it records the original type again, with InverseOf
+	// naming the undo.
+	OpUndo OpType = "undo"
+
+	// OpPrune records a Prune. Its pruned metadata lists the chain positions
+	// of the operations it deleted, so Verify can tell them from operations
+	// removed outside breathe. Prune records are never pruned themselves.
+	OpPrune OpType = "prune"
+)
+
+// ValidType reports whether t is a known operation type.
+func ValidType(t OpType) bool {
+	switch t {
+	case OpMove, OpDelete, OpTrash, OpRestore, OpPurge, OpQuarantine, OpShred, OpUndo, OpPrune:
+		return true
+	}
+	return false
+}
+
+// State tracks what happened to an operation after it was recorded.
+type State string
+
+const (
+	StateApplied State = "applied" // Its effect is in place
+	StateUndone  State = "undone"  // Reverted by the operation whose InverseOf names it
+	StateRedone  State = "redone"  // Undone, then applied again by a redo
+	StateFailed  State = "failed"  // Its filesystem step failed or was interrupted
+	StatePending State = "pending" // Recorded by Begin; its filesystem step hasn't finished
 )
 
 type Operation struct {
@@ -29,18 +75,45 @@ type Operation struct {
 	FileHash   string
 	Reversible bool
 	Metadata   map[string]string
+	BatchID    string // Groups the operations of one organize run, clean or TUI session
+	State      State  // StateApplied when recorded
+	InverseOf  int64  // The operation this one undoes, redoes, restores or purges, or 0
+}
+
+// NewBatchID returns a unique, time-ordered batch ID.
+func NewBatchID() string {
+	var b [3]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102-150405"), b)
 }
 
 type DB struct {
-	db *sql.DB
+	db        *sql.DB
+	recovered []Recovery
 }
 
+// BusyTimeout is how long a connection waits for another process holding
+// the database lock, such as the TUI and a cron clean writing at once.
+const BusyTimeout = 10 * time.Second
+
 func Open(path string) (*DB, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", path)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// WAL lets readers and a writer work concurrently. Transactions take the
+	// write lock when they begin, so they wait for it instead of failing
+	// with SQLITE_BUSY when a read turns into a write.
+	dsn := url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: url.Values{
+		"_pragma": {fmt.Sprintf("busy_timeout(%d)", BusyTimeout.Milliseconds()), "journal_mode(WAL)"},
+		"_txlock": {"immediate"},
+	}.Encode()}
+	db, err := sql.Open("sqlite", dsn.String())
 	if err != nil {
 		return nil, err
 	}
@@ -50,53 +123,196 @@ func Open(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
-}
-
-func migrate(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS operations (
-			id INTEGER PRIMARY KEY,
-			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-			operation TEXT NOT NULL,
-			source_path TEXT NOT NULL,
-			dest_path TEXT,
-			file_size INTEGER,
-			file_hash TEXT,
-			reversible BOOLEAN DEFAULT 0,
-			metadata JSON
-		);
-		CREATE INDEX IF NOT EXISTS idx_source ON operations(source_path);
-		CREATE INDEX IF NOT EXISTS idx_timestamp ON operations(timestamp);
-	`)
-	return err
+	d := &DB{db: db}
+	if d.recovered, err = d.Recover(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("recovering interrupted operations: %w", err)
+	}
+	return d, nil
+}
+
+// Recovered returns the interrupted operations Open reconciled.
+func (d *DB) Recovered() []Recovery {
+	return d.recovered
 }
 
 func (d *DB) Close() error {
 	return d.db.Close()
 }
 
+// Record stores op, sealing it into the hash chain unless it is pending.
 func (d *DB) Record(op Operation) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insert(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	if op.State != StatePending {
+		if err := seal(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// ErrNotRecorded marks an operation that was carried out but is missing from
+// the history, so it can't be undone through breathe.
+var ErrNotRecorded = errors.New("not recorded in history")
+
+// NotRecordedError reports a completed operation that Record failed to store.
+type NotRecordedError struct {
+	Op  Operation
+	Err error
+}
+
+func (e *NotRecordedError) Error() string {
+	return fmt.Sprintf("%s %s done but %v: %v", e.Op.Type, e.Op.SourcePath, ErrNotRecorded, e.Err)
+}
+
+func (e *NotRecordedError) Unwrap() error {
+	return ErrNotRecorded
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insert(e execer, op Operation) (int64, error) {
 	metadata, _ := json.Marshal(op.Metadata)
+	if op.State == "" {
+		op.State = StateApplied
+	}
+
+	// A zero Timestamp means now; imported operations keep theirs
+	var timestamp any
+	if !op.Timestamp.IsZero() {
+		timestamp = formatTimestamp(op.Timestamp)
+	}
 
-	result, err := d.db.Exec(`
-		INSERT INTO operations (operation, source_path, dest_path, file_size, file_hash, reversible, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, op.Type, op.SourcePath, op.DestPath, op.FileSize, op.FileHash, op.Reversible, string(metadata))
+	result, err := e.Exec(`
+		INSERT INTO operations (timestamp, operation, source_path, dest_path, file_size, file_hash, reversible, metadata, batch_id, state, inverse_of)
+		VALUES (COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, timestamp, op.Type, op.SourcePath, op.DestPath, op.FileSize, op.FileHash, op.Reversible, string(metadata),
+		nullString(op.BatchID), op.State, nullInt(op.InverseOf))
 	if err != nil {
 		return 0, err
 	}
 	return result.LastInsertId()
 }
 
+// Filter selects operations. Zero fields match everything.
+type Filter struct {
+	Match      string // Full-text query; see ParseMatch
+	Text       string // Substring of the source or destination path
+	Types      []OpType
+	MinSize    int64
+	MaxSize    int64 // 0 for no limit
+	From       time.Time
+	To         time.Time // Exclusive
+	Reversible bool      // Only operations that can still be undone
+	BatchID    string
+	PathPrefix string // Source or destination is this path or under it
+}
+
+// Query returns the operations matching f, newest first, or best match first
+// when f.Match is set.
+func (d *DB) Query(f Filter) ([]Operation, error) {
+	var where []string
+	var args []any
+	add := func(cond string, a ...any) {
+		where = append(where, cond)
+		args = append(args, a...)
+	}
+
+	from := `operations`
+	order := `timestamp DESC, id DESC`
+	if f.Match != "" {
+		expr, err := ParseMatch(f.Match)
+		if err != nil {
+			return nil, err
+		}
+		from += ` JOIN operations_fts ON operations_fts.rowid = operations.id`
+		order = `operations_fts.rank, ` + order
+		add(`operations_fts MATCH ?`, expr)
+	}
+	if f.Text != "" {
+		pattern := "%" + f.Text + "%"
+		add(`(source_path LIKE ? OR dest_path LIKE ?)`, pattern, pattern)
+	}
+	if len(f.Types) > 0 {
+		marks := strings.TrimSuffix(strings.Repeat("?,", len(f.Types)), ",")
+		var types []any
+		for _, t := range f.Types {
+			types = append(types, t)
+		}
+		add(`operation IN (`+marks+`)`, types...)
+	}
+	if f.MinSize > 0 {
+		add(`file_size >= ?`, f.MinSize)
+	}
+	if f.MaxSize > 0 {
+		add(`file_size <= ?`, f.MaxSize)
+	}
+	if !f.From.IsZero() {
+		add(`timestamp >= ?`, formatTimestamp(f.From))
+	}
+	if !f.To.IsZero() {
+		add(`timestamp < ?`, formatTimestamp(f.To))
+	}
+	if f.Reversible {
+		add(`reversible = 1`)
+	}
+	if f.BatchID != "" {
+		add(`batch_id = ?`, f.BatchID)
+	}
+	if f.PathPrefix != "" {
+		prefix := strings.TrimSuffix(f.PathPrefix, "/")
+		under := escapeLike(prefix) + "/%"
+		add(`(source_path = ? OR source_path LIKE ? ESCAPE '\' OR dest_path = ? OR dest_path LIKE ? ESCAPE '\')`,
+			prefix, under, prefix, under)
+	}
+
+	query := `SELECT ` + opColumns + ` FROM ` + from
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	rows, err := d.db.Query(query+` ORDER BY `+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
+
+// escapeLike escapes LIKE wildcards in s, using backslash as the escape.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Search returns the operations matching a full-text query (see ParseMatch),
+// best match first.
 func (d *DB) Search(query string) ([]Operation, error) {
-	pattern := "%" + query + "%"
+	return d.Query(Filter{Match: query})
+}
+
+func (d *DB) Since(t time.Time) ([]Operation, error) {
+	return d.Query(Filter{From: t})
+}
+
+// Reversible returns operations of the given type that can still be undone,
+// newest first.
+func (d *DB) Reversible(opType OpType) ([]Operation, error) {
 	rows, err := d.db.Query(`
-		SELECT id, timestamp, operation, source_path, dest_path, file_size, file_hash, reversible, metadata
+		SELECT `+opColumns+`
 		FROM operations
-		WHERE source_path LIKE ? OR dest_path LIKE ?
-		ORDER BY timestamp DESC
-	`, pattern, pattern)
+		WHERE operation = ? AND reversible = 1
+		ORDER BY timestamp DESC, id DESC
+	`, opType)
 	if err != nil {
 		return nil, err
 	}
@@ -104,13 +320,78 @@ func (d *DB) Search(query string) ([]Operation, error) {
 	return scanOperations(rows)
 }
 
-func (d *DB) Since(t time.Time) ([]Operation, error) {
+// RecordUndo records undo, which reverted the operation with ID undone, and
+// marks that operation undone so it can't be undone again. Both happen in one
+// transaction.
+func (d *DB) RecordUndo(undone int64, undo Operation) (int64, error) {
+	undo.Type = OpUndo
+	undo.InverseOf = undone
+	return d.recordInverse(undo)
+}
+
+// RecordRedo records redo, which applied the operation reverted by undo
+// again. The undo is marked undone and the operation it reverted redone;
+// redo itself is what a later undo reverts.
+func (d *DB) RecordRedo(undo Operation, redo Operation) (int64, error) {
+	redo.InverseOf = undo.ID
+	return d.recordInverse(redo)
+}
+
+// recordInverse inserts op and updates the operations it inverts in one
+// transaction.
+func (d *DB) recordInverse(op Operation) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insert(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	if err := seal(tx, id); err != nil {
+		return 0, err
+	}
+	if err := applyInverse(tx, op); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// applyInverse updates the states of the operations op inverts. An undo
+// marks what it reverted undone; a redo marks the undo it reverted undone
+// and the operation that undo reverted redone. A restore or purge only makes
+// the trash or quarantine operation irreversible, since its item is gone.
+func applyInverse(e execer, op Operation) error {
+	if op.InverseOf == 0 {
+		return nil
+	}
+	if op.Type == OpRestore || op.Type == OpPurge {
+		_, err := e.Exec(`UPDATE operations SET reversible = 0 WHERE id = ?`, op.InverseOf)
+		return err
+	}
+	if op.Type == OpUndo {
+		_, err := e.Exec(`UPDATE operations SET state = 'undone', reversible = 0 WHERE id = ?`, op.InverseOf)
+		return err
+	}
+	_, err := e.Exec(`
+		UPDATE operations
+		SET state = CASE id WHEN ?1 THEN 'undone' ELSE 'redone' END, reversible = 0
+		WHERE id = ?1 OR id = (SELECT inverse_of FROM operations WHERE id = ?1)
+	`, op.InverseOf)
+	return err
+}
+
+// Inverses returns the operations that undo or redo the operation with the
+// given ID, including failed attempts, in the order they were recorded.
+func (d *DB) Inverses(id int64) ([]Operation, error) {
 	rows, err := d.db.Query(`
-		SELECT id, timestamp, operation, source_path, dest_path, file_size, file_hash, reversible, metadata
+		SELECT `+opColumns+`
 		FROM operations
-		WHERE timestamp >= ?
-		ORDER BY timestamp DESC
-	`, t)
+		WHERE inverse_of = ?
+		ORDER BY id
+	`, id)
 	if err != nil {
 		return nil, err
 	}
@@ -118,50 +399,139 @@ func (d *DB) Since(t time.Time) ([]Operation, error) {
 	return scanOperations(rows)
 }
 
-func (d *DB) Get(id int64) (*Operation, error) {
-	row := d.db.QueryRow(`
-		SELECT id, timestamp, operation, source_path, dest_path, file_size, file_hash, reversible, metadata
-		FROM operations WHERE id = ?
-	`, id)
+// Root follows InverseOf links from the operation with the given ID back to
+// the operation that started its undo/redo chain, or the oldest one left
+// after pruning.
+func (d *DB) Root(id int64) (*Operation, error) {
+	op, err := d.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	// Inverses are always recorded after what they invert
+	for op.InverseOf != 0 && op.InverseOf < op.ID {
+		parent, err := d.Get(op.InverseOf)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		op = parent
+	}
+	return op, nil
+}
 
-	var op Operation
-	var ts string
-	var destPath sql.NullString
-	var metadata sql.NullString
+// Chains returns every operation in the undo/redo chains of ops, including
+// ops themselves, in the order they were recorded. It reads them in one query,
+// so callers can follow InverseOf links in memory.
+func (d *DB) Chains(ops []Operation) ([]Operation, error) {
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(ops))
+	for i, op := range ops {
+		ids[i] = strconv.FormatInt(op.ID, 10)
+	}
+	// IDs come from the database, so they are safe to inline. Walk up to
+	// the roots first, then down to everything that inverts them.
+	rows, err := d.db.Query(`
+		WITH RECURSIVE
+			up(id, inverse_of) AS (
+				SELECT id, inverse_of FROM operations WHERE id IN (` + strings.Join(ids, ",") + `)
+				UNION
+				SELECT o.id, o.inverse_of FROM operations o JOIN up ON o.id = up.inverse_of AND o.id < up.id
+			),
+			down(id) AS (
+				SELECT id FROM up
+				UNION
+				SELECT o.id FROM operations o JOIN down ON o.inverse_of = down.id
+			)
+		SELECT ` + opColumns + `
+		FROM operations
+		WHERE id IN (SELECT id FROM down)
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
 
-	err := row.Scan(&op.ID, &ts, &op.Type, &op.SourcePath, &destPath, &op.FileSize, &op.FileHash, &op.Reversible, &metadata)
+func (d *DB) SetReversible(id int64, reversible bool) error {
+	_, err := d.db.Exec(`UPDATE operations SET reversible = ? WHERE id = ?`, reversible, id)
+	return err
+}
+
+// Batch returns the operations of a batch in the order they were recorded.
+func (d *DB) Batch(batchID string) ([]Operation, error) {
+	rows, err := d.db.Query(`
+		SELECT `+opColumns+`
+		FROM operations
+		WHERE batch_id = ?
+		ORDER BY id
+	`, batchID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
 
-	op.Timestamp, _ = time.Parse("2006-01-02 15:04:05", ts)
-	if destPath.Valid {
-		op.DestPath = destPath.String
+// LastBatch returns the most recent batch that still has reversible
+// operations, or "" if there is none.
+func (d *DB) LastBatch() (string, error) {
+	var batchID string
+	err := d.db.QueryRow(`
+		SELECT batch_id FROM operations
+		WHERE batch_id IS NOT NULL AND reversible = 1
+		ORDER BY id DESC LIMIT 1
+	`).Scan(&batchID)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-	if metadata.Valid {
-		json.Unmarshal([]byte(metadata.String), &op.Metadata)
+	return batchID, err
+}
+
+func (d *DB) Get(id int64) (*Operation, error) {
+	rows, err := d.db.Query(`SELECT `+opColumns+` FROM operations WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return &op, nil
+	ops, err := scanOperations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &ops[0], nil
 }
 
+const opColumns = `id, timestamp, operation, source_path, dest_path, file_size, file_hash, reversible, metadata, batch_id, state, inverse_of`
+
 func scanOperations(rows *sql.Rows) ([]Operation, error) {
 	var ops []Operation
 	for rows.Next() {
 		var op Operation
 		var ts string
-		var destPath sql.NullString
-		var metadata sql.NullString
+		var destPath, fileHash, metadata, batchID sql.NullString
+		var fileSize, inverseOf sql.NullInt64
 
-		err := rows.Scan(&op.ID, &ts, &op.Type, &op.SourcePath, &destPath, &op.FileSize, &op.FileHash, &op.Reversible, &metadata)
+		err := rows.Scan(&op.ID, &ts, &op.Type, &op.SourcePath, &destPath, &fileSize, &fileHash, &op.Reversible, &metadata, &batchID,
+			&op.State, &inverseOf)
 		if err != nil {
 			return nil, err
 		}
 
-		op.Timestamp, _ = time.Parse("2006-01-02 15:04:05", ts)
-		if destPath.Valid {
-			op.DestPath = destPath.String
-		}
+		op.Timestamp = parseTimestamp(ts)
+		op.DestPath = destPath.String
+		op.FileSize = fileSize.Int64
+		op.FileHash = fileHash.String
+		op.BatchID = batchID.String
+		op.InverseOf = inverseOf.Int64
 		if metadata.Valid {
 			json.Unmarshal([]byte(metadata.String), &op.Metadata)
 		}
@@ -171,6 +541,38 @@ func scanOperations(rows *sql.Rows) ([]Operation, error) {
 	return ops, rows.Err()
 }
 
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// timestampLayout matches SQLite's CURRENT_TIMESTAMP, which is always UTC.
+const timestampLayout = "2006-01-02 15:04:05"
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// parseTimestamp accepts both the stored layout and the RFC 3339 form the
+// driver reports for DATETIME columns.
+func parseTimestamp(ts string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, timestampLayout} {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 func FormatSize(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -1,8 +1,10 @@
 package history
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -82,3 +84,234 @@ func TestDB_CreatesDirectory(t *testing.T) {
 		t.Error("database file was not created")
 	}
 }
+
+func TestDB_ReversibleAndSetReversible(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	id, _ := db.Record(Operation{Type: OpTrash, SourcePath: "/a", DestPath: "/trash/a", Reversible: true})
+	db.Record(Operation{Type: OpTrash, SourcePath: "/b", DestPath: "/trash/b", Reversible: true})
+	db.Record(Operation{Type: OpDelete, SourcePath: "/c"})
+
+	ops, err := db.Reversible(OpTrash)
+	if err != nil {
+		t.Fatalf("Reversible() error = %v", err)
+	}
+	if len(ops) != 2 {
+		t.Fatalf("expected 2 reversible trash ops, got %d", len(ops))
+	}
+
+	if err := db.SetReversible(id, false); err != nil {
+		t.Fatalf("SetReversible() error = %v", err)
+	}
+	ops, _ = db.Reversible(OpTrash)
+	if len(ops) != 1 || ops[0].SourcePath != "/b" {
+		t.Errorf("expected only /b to remain reversible, got %v", ops)
+	}
+}
+
+func TestDB_TimestampIsParsed(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	id, _ := db.Record(Operation{Type: OpMove, SourcePath: "/a", DestPath: "/b"})
+	op, err := db.Get(id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if time.Since(op.Timestamp) > time.Minute || time.Since(op.Timestamp) < -time.Minute {
+		t.Errorf("expected a recent timestamp, got %v", op.Timestamp)
+	}
+}
+
+func TestDB_Batches(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	first, second := NewBatchID(), NewBatchID()
+	if first == second {
+		t.Fatal("batch IDs should be unique")
+	}
+	db.Record(Operation{Type: OpMove, SourcePath: "/a", DestPath: "/x/a", Reversible: true, BatchID: first})
+	db.Record(Operation{Type: OpMove, SourcePath: "/b", DestPath: "/x/b", Reversible: true, BatchID: first})
+	db.Record(Operation{Type: OpTrash, SourcePath: "/c", DestPath: "/t/c", Reversible: true, BatchID: second})
+	db.Record(Operation{Type: OpDelete, SourcePath: "/d"})
+
+	ops, err := db.Batch(first)
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	if len(ops) != 2 || ops[0].SourcePath != "/a" || ops[1].BatchID != first {
+		t.Errorf("unexpected batch %v", ops)
+	}
+
+	last, err := db.LastBatch()
+	if err != nil || last != second {
+		t.Errorf("LastBatch() = %q, %v; want %q", last, err, second)
+	}
+
+	// Batches with nothing left to undo are passed over
+	third, _ := db.Batch(second)
+	db.SetReversible(third[0].ID, false)
+	if last, _ := db.LastBatch(); last != first {
+		t.Errorf("LastBatch() = %q, want %q", last, first)
+	}
+}
+
+func TestDB_Query(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	batch := NewBatchID()
+	db.Record(Operation{Type: OpDelete, SourcePath: "/work/app/node_modules", FileSize: 500, BatchID: batch})
+	db.Record(Operation{Type: OpTrash, SourcePath: "/work/app/dist", DestPath: "/t/dist", FileSize: 50, Reversible: true, BatchID: batch})
+	db.Record(Operation{Type: OpMove, SourcePath: "/work/app_old/a.txt", DestPath: "/docs/a.txt", FileSize: 5, Reversible: true})
+	db.Record(Operation{Type: OpMove, SourcePath: "/dl/b.txt", DestPath: "/work/app/b.txt", FileSize: 1})
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 4},
+		{"types", Filter{Types: []OpType{OpDelete, OpTrash}}, 2},
+		{"size range", Filter{MinSize: 5, MaxSize: 100}, 2},
+		{"reversible", Filter{Reversible: true}, 2},
+		{"batch", Filter{BatchID: batch}, 2},
+		{"path prefix matches source or dest, not siblings", Filter{PathPrefix: "/work/app/"}, 3},
+		{"combined", Filter{PathPrefix: "/work/app", Reversible: true}, 1},
+		{"future", Filter{From: time.Now().Add(time.Hour)}, 0},
+		{"to", Filter{To: time.Now().Add(time.Hour)}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := db.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(ops) != tt.want {
+				t.Errorf("got %d operations, want %d", len(ops), tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_UndoRedoChain(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	id, _ := db.Record(Operation{Type: OpMove, SourcePath: "/a", DestPath: "/x/a", Reversible: true})
+	undoID, err := db.RecordUndo(id, Operation{SourcePath: "/x/a", DestPath: "/a"})
+	if err != nil {
+		t.Fatalf("RecordUndo() error = %v", err)
+	}
+	op, _ := db.Get(id)
+	if op.State != StateUndone || op.Reversible {
+		t.Errorf("undone operation has state %s, reversible %v", op.State, op.Reversible)
+	}
+
+	undo, _ := db.Get(undoID)
+	redoID, err := db.RecordRedo(*undo, Operation{Type: OpMove, SourcePath: "/a", DestPath: "/x/a", Reversible: true})
+	if err != nil {
+		t.Fatalf("RecordRedo() error = %v", err)
+	}
+	op, _ = db.Get(id)
+	undo, _ = db.Get(undoID)
+	redo, _ := db.Get(redoID)
+	if op.State != StateRedone || undo.State != StateUndone || redo.State != StateApplied || !redo.Reversible {
+		t.Errorf("unexpected states: op %s, undo %s, redo %s", op.State, undo.State, redo.State)
+	}
+
+	if inv, _ := db.Inverses(undoID); len(inv) != 1 || inv[0].ID != redoID {
+		t.Errorf("expected the redo to invert the undo, got %v", inv)
+	}
+	if root, err := db.Root(redoID); err != nil || root.ID != id {
+		t.Errorf("Root() = %v, %v; want operation %d", root, err, id)
+	}
+
+	other, _ := db.Record(Operation{Type: OpDelete, SourcePath: "/b"})
+	chain, err := db.Chains([]Operation{*redo})
+	if err != nil {
+		t.Fatalf("Chains() error = %v", err)
+	}
+	if len(chain) != 3 || chain[0].ID != id || chain[1].ID != undoID || chain[2].ID != redoID {
+		t.Errorf("Chains() = %v; want operations %d, %d, %d", chain, id, undoID, redoID)
+	}
+	for _, op := range chain {
+		if op.ID == other {
+			t.Error("Chains() returned an unrelated operation")
+		}
+	}
+}
+
+func TestDB_ConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// Separate handles stand in for separate processes: the TUI, a cron
+	// clean and an organize run
+	const writers, perWriter = 4, 25
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			db, err := Open(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+
+			for i := 0; i < perWriter; i++ {
+				id, err := db.Record(Operation{Type: OpMove, SourcePath: fmt.Sprintf("/w%d/%d", w, i), DestPath: "/x", Reversible: true})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if i%5 == 0 {
+					if _, err := db.RecordUndo(id, Operation{SourcePath: "/x", DestPath: "/y"}); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	var mode string
+	db.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	if mode != "wal" {
+		t.Errorf("journal mode = %q, want wal", mode)
+	}
+	ops, _ := db.Query(Filter{})
+	if want := writers * (perWriter + perWriter/5); len(ops) != want {
+		t.Errorf("got %d operations, want %d", len(ops), want)
+	}
+}
@@ -0,0 +1,263 @@
+package history
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Format is a file format for Export and ReadExport.
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl" // One operation per line, shaped like history --json
+	FormatCSV   Format = "csv"   // Metadata as a JSON object in one column
+)
+
+// csvHeader names the CSV columns after the JSON fields of Operation.
+var csvHeader = []string{"ID", "Timestamp", "Type", "SourcePath", "DestPath", "FileSize", "FileHash",
+	"Reversible", "Metadata", "BatchID", "State", "InverseOf"}
+
+// Export writes ops to w in format.
+func Export(w io.Writer, ops []Operation, format Format) error {
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, op := range ops {
+			if err := enc.Encode(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, op := range ops {
+			cw.Write([]string{
+				strconv.FormatInt(op.ID, 10),
+				op.Timestamp.UTC().Format(time.RFC3339),
+				string(op.Type),
+				op.SourcePath,
+				op.DestPath,
+				strconv.FormatInt(op.FileSize, 10),
+				op.FileHash,
+				strconv.FormatBool(op.Reversible),
+				mustJSON(op.Metadata),
+				op.BatchID,
+				string(op.State),
+				strconv.FormatInt(op.InverseOf, 10),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// ReadExport reads operations written by Export. For FormatJSONL it also
+// accepts the JSON array history --json prints.
+func ReadExport(r io.Reader, format Format) ([]Operation, error) {
+	switch format {
+	case FormatJSONL:
+		return readJSON(r)
+	case FormatCSV:
+		return readCSV(r)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+func readJSON(r io.Reader) ([]Operation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var ops []Operation
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, err
+		}
+		return ops, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var ops []Operation
+	for n := 1; ; n++ {
+		var op Operation
+		if err := dec.Decode(&op); err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+func readCSV(r io.Reader) ([]Operation, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var ops []Operation
+	for i, rec := range records[1:] {
+		op, err := parseCSVRecord(rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func parseCSVRecord(rec []string) (Operation, error) {
+	op := Operation{
+		Type:       OpType(rec[2]),
+		SourcePath: rec[3],
+		DestPath:   rec[4],
+		FileHash:   rec[6],
+		BatchID:    rec[9],
+		State:      State(rec[10]),
+	}
+	var err error
+	if op.ID, err = strconv.ParseInt(rec[0], 10, 64); err != nil {
+		return op, fmt.Errorf("invalid ID %q", rec[0])
+	}
+	if op.Timestamp, err = time.Parse(time.RFC3339, rec[1]); err != nil {
+		return op, fmt.Errorf("invalid timestamp %q", rec[1])
+	}
+	if op.FileSize, err = strconv.ParseInt(rec[5], 10, 64); err != nil {
+		return op, fmt.Errorf("invalid file size %q", rec[5])
+	}
+	if op.Reversible, err = strconv.ParseBool(rec[7]); err != nil {
+		return op, fmt.Errorf("invalid reversible %q", rec[7])
+	}
+	if rec[8] != "" {
+		if err := json.Unmarshal([]byte(rec[8]), &op.Metadata); err != nil {
+			return op, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	if op.InverseOf, err = strconv.ParseInt(rec[11], 10, 64); err != nil {
+		return op, fmt.Errorf("invalid inverse ID %q", rec[11])
+	}
+	return op, nil
+}
+
+// ImportResult reports what Import added.
+type ImportResult struct {
+	Imported   int
+	Duplicates int             // Already in the database, so skipped
+	Orphans    int             // Reversible where exported, but their item isn't here
+	IDs        map[int64]int64 // Exported IDs to IDs in this database
+}
+
+// linkedIDs are metadata keys that held the ID of another operation in
+// exports from before restores and purges recorded it in InverseOf.
+var linkedIDs = []string{"trash_op_id", "quarantine_op_id"}
+
+// Import merges ops, such as those read from another machine's export, in
+// one transaction. Operations get new IDs, and references between them are
+// remapped; references to operations not in ops are dropped. An operation
+// already recorded with the same time, type, paths, size and batch is a
+// duplicate and is skipped, so importing the same export twice is harmless.
+// Pending operations are imported as failed, since they can't be recovered
+// here, and reversible operations whose DestPath doesn't exist here are
+// marked orphaned, as Prune does. Prune records are skipped, since they list
+// positions in the exporting database's hash chain.
+func (d *DB) Import(ops []Operation, dryRun bool) (*ImportResult, error) {
+	for _, op := range ops {
+		if !ValidType(op.Type) {
+			return nil, fmt.Errorf("operation %d: unknown type %q", op.ID, op.Type)
+		}
+	}
+	// Oldest first, so operations are imported before their inverses
+	ops = append([]Operation(nil), ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res := &ImportResult{IDs: make(map[int64]int64)}
+	for _, op := range ops {
+		if op.Type == OpPrune {
+			continue
+		}
+		var existing int64
+		err := tx.QueryRow(`
+			SELECT id FROM operations
+			WHERE timestamp = ? AND operation = ? AND source_path = ? AND IFNULL(dest_path, '') = ?
+				AND IFNULL(file_size, 0) = ? AND IFNULL(batch_id, '') = ?
+			LIMIT 1
+		`, formatTimestamp(op.Timestamp), op.Type, op.SourcePath, op.DestPath, op.FileSize, op.BatchID).Scan(&existing)
+		if err == nil {
+			res.IDs[op.ID] = existing
+			res.Duplicates++
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		exportedID := op.ID
+		op.InverseOf = res.IDs[op.InverseOf]
+		metadata := make(map[string]string)
+		for k, v := range op.Metadata {
+			metadata[k] = v
+		}
+		for _, key := range linkedIDs {
+			if v, ok := metadata[key]; ok {
+				id, _ := strconv.ParseInt(v, 10, 64)
+				if res.IDs[id] != 0 {
+					metadata[key] = strconv.FormatInt(res.IDs[id], 10)
+				} else {
+					delete(metadata, key)
+				}
+			}
+		}
+		if op.State == StatePending {
+			op.State = StateFailed
+			op.Reversible = false
+			delete(metadata, "pid")
+			metadata["error"] = "pending when exported"
+		}
+		if op.Reversible {
+			if _, err := os.Lstat(op.DestPath); err != nil {
+				op.Reversible = false
+				metadata["orphaned"] = formatTimestamp(now)
+				res.Orphans++
+			}
+		}
+		op.Metadata = metadata
+
+		id, err := insert(tx, op)
+		if err == nil {
+			err = seal(tx, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", exportedID, err)
+		}
+		res.IDs[exportedID] = id
+		res.Imported++
+	}
+
+	if dryRun {
+		return res, nil
+	}
+	return res, tx.Commit()
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func exportFixture() []Operation {
+	ts := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	return []Operation{
+		{ID: 7, Timestamp: ts, Type: OpTrash, SourcePath: "/p/old", DestPath: "/t/old", FileSize: 10,
+			Metadata: map[string]string{"reason": "a, \"quoted\" note"}, BatchID: "b1", State: StateUndone},
+		{ID: 9, Timestamp: ts.Add(time.Minute), Type: OpUndo, SourcePath: "/t/old", DestPath: "/p/old", FileSize: 10,
+			State: StateApplied, InverseOf: 7},
+		{ID: 12, Timestamp: ts.Add(2 * time.Minute), Type: OpPurge, SourcePath: "/t/x", State: StateApplied,
+			Metadata: map[string]string{"trash_op_id": "7", "original_path": "/p/x"}},
+		{ID: 13, Timestamp: ts.Add(3 * time.Minute), Type: OpMove, SourcePath: "/a", DestPath: "/b", State: StatePending,
+			Metadata: map[string]string{"pid": "1"}},
+	}
+}
+
+func TestExport_RoundTrip(t *testing.T) {
+	ops := exportFixture()
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		var buf bytes.Buffer
+		if err := Export(&buf, ops, format); err != nil {
+			t.Fatalf("Export(%s) error = %v", format, err)
+		}
+		got, err := ReadExport(&buf, format)
+		if err != nil {
+			t.Fatalf("ReadExport(%s) error = %v", format, err)
+		}
+		if !reflect.DeepEqual(got, ops) {
+			t.Errorf("%s round trip = %+v, want %+v", format, got, ops)
+		}
+	}
+
+	// history --json prints an array of the same objects
+	data, _ := json.MarshalIndent(ops, "", "  ")
+	got, err := ReadExport(bytes.NewReader(data), FormatJSONL)
+	if err != nil || len(got) != len(ops) {
+		t.Errorf("reading a JSON array: %d operations, error %v", len(got), err)
+	}
+}
+
+func TestDB_Import(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	db.Record(Operation{Type: OpDelete, SourcePath: "/already/here"})
+
+	ops := exportFixture()
+	res, err := db.Import(ops, false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if res.Imported != 4 || res.Duplicates != 0 {
+		t.Fatalf("imported %d, %d duplicates; want 4, 0", res.Imported, res.Duplicates)
+	}
+
+	trashed, _ := db.Get(res.IDs[7])
+	if trashed.ID == 7 || !trashed.Timestamp.Equal(ops[0].Timestamp) || trashed.State != StateUndone {
+		t.Errorf("unexpected imported trash %+v", trashed)
+	}
+	if undo, _ := db.Get(res.IDs[9]); undo.InverseOf != trashed.ID {
+		t.Errorf("undo reverts %d, want remapped %d", undo.InverseOf, trashed.ID)
+	}
+	if purge, _ := db.Get(res.IDs[12]); purge.Metadata["trash_op_id"] != strconv.FormatInt(trashed.ID, 10) {
+		t.Errorf("purge metadata %v not remapped to %d", purge.Metadata, trashed.ID)
+	}
+	if move, _ := db.Get(res.IDs[13]); move.State != StateFailed || move.Metadata["pid"] != "" {
+		t.Errorf("expected the pending move imported as failed, got %+v", move)
+	}
+
+	// Importing again only finds duplicates
+	res, err = db.Import(ops, false)
+	if err != nil || res.Imported != 0 || res.Duplicates != 4 {
+		t.Errorf("reimport: %+v, error %v", res, err)
+	}
+
+	if _, err := db.Import([]Operation{{Type: "bogus", SourcePath: "/x"}}, false); err == nil {
+		t.Error("expected an unknown type to be rejected")
+	}
+}
+
+func TestDB_ImportOrphans(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := Open(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	here := filepath.Join(tmpDir, "here")
+	os.WriteFile(here, []byte("x"), 0644)
+	ts := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	res, err := db.Import([]Operation{
+		{ID: 1, Timestamp: ts, Type: OpTrash, SourcePath: "/p/a", DestPath: here, Reversible: true, State: StateApplied},
+		{ID: 2, Timestamp: ts, Type: OpMove, SourcePath: "/p/b", DestPath: filepath.Join(tmpDir, "elsewhere"),
+			Reversible: true, State: StateApplied},
+	}, false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if res.Orphans != 1 {
+		t.Errorf("found %d orphans, want 1", res.Orphans)
+	}
+	if op, _ := db.Get(res.IDs[1]); !op.Reversible || op.Metadata["orphaned"] != "" {
+		t.Errorf("operation whose item is here should stay reversible, got %+v", op)
+	}
+	if op, _ := db.Get(res.IDs[2]); op.Reversible || op.Metadata["orphaned"] == "" {
+		t.Errorf("operation whose item is missing should be orphaned, got %+v", op)
+	}
+	if v, err := db.Verify(); err != nil || v.Broken != nil {
+		t.Errorf("Verify() = %+v, %v", v, err)
+	}
+}
@@ -0,0 +1,169 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Begin records op as pending before its filesystem step, so a crash in
+// between leaves a trace that Recover can reconcile. Follow it with Complete
+// or Fail. A pending operation is never reversible.
+func (d *DB) Begin(op Operation) (int64, error) {
+	metadata := map[string]string{"pid": strconv.Itoa(os.Getpid())}
+	for k, v := range op.Metadata {
+		metadata[k] = v
+	}
+	op.Metadata = metadata
+	op.State = StatePending
+	op.Reversible = false
+	return insert(d.db, op)
+}
+
+// Complete records the outcome of the pending operation id, replacing its
+// destination, hash, reversibility and metadata with op's, and updates the
+// operations it inverts. It all happens in one transaction.
+func (d *DB) Complete(id int64, op Operation) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	metadata, _ := json.Marshal(op.Metadata)
+	result, err := tx.Exec(`
+		UPDATE operations
+		SET dest_path = ?, file_size = ?, file_hash = ?, reversible = ?, metadata = ?, state = 'applied'
+		WHERE id = ? AND state = 'pending'
+	`, op.DestPath, op.FileSize, op.FileHash, op.Reversible, string(metadata), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("operation %d is not pending", id)
+	}
+	if err := seal(tx, id); err != nil {
+		return err
+	}
+	if err := applyInverse(tx, op); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Fail marks the pending operation id failed with the error that stopped it.
+func (d *DB) Fail(id int64, cause error) error {
+	return d.fail(id, `json_set(CASE WHEN json_valid(metadata) AND json_type(metadata) = 'object' THEN metadata ELSE '{}' END, '$.error', ?)`,
+		cause.Error())
+}
+
+// fail marks the pending operation id failed and seals it, setting its
+// metadata to the SQL expression metadata.
+func (d *DB) fail(id int64, metadata string, arg any) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE operations SET state = 'failed', metadata = `+metadata+` WHERE id = ? AND state = 'pending'`, arg, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return err
+	}
+	if err := seal(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recovery describes how Recover reconciled an interrupted operation.
+type Recovery struct {
+	Op        Operation `json:"operation"`
+	Completed bool      `json:"completed"` // The filesystem step had finished; otherwise marked failed
+	Reason    string    `json:"reason"`    // What the filesystem showed
+}
+
+// Recover reconciles pending operations left by processes that are no longer
+// running with the filesystem: operations whose effect is in place are
+// completed, the rest marked failed. Operations of running processes are
+// left alone, since they may still finish.
+func (d *DB) Recover() ([]Recovery, error) {
+	pending, err := d.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []Recovery
+	for _, op := range pending {
+		if pid, err := strconv.Atoi(op.Metadata["pid"]); err == nil && processAlive(pid) {
+			continue
+		}
+
+		r := reconcile(op)
+		if r.Completed {
+			err = d.Complete(op.ID, r.Op)
+		} else {
+			err = d.fail(op.ID, `?`, mustJSON(r.Op.Metadata))
+		}
+		if err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, r)
+	}
+	return recovered, nil
+}
+
+// Pending returns operations whose filesystem step hasn't finished, oldest
+// first.
+func (d *DB) Pending() ([]Operation, error) {
+	rows, err := d.db.Query(`SELECT ` + opColumns + ` FROM operations WHERE state = 'pending' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOperations(rows)
+}
+
+// reconcile works out from the filesystem whether op's step finished.
+func reconcile(op Operation) Recovery {
+	metadata := make(map[string]string)
+	for k, v := range op.Metadata {
+		if k != "pid" {
+			metadata[k] = v
+		}
+	}
+	op.Metadata = metadata
+	r := Recovery{Op: op}
+	_, srcErr := os.Lstat(op.SourcePath)
+	srcGone := os.IsNotExist(srcErr)
+
+	switch {
+	case !srcGone:
+		r.Reason = fmt.Sprintf("interrupted; %s is still there", op.SourcePath)
+	case op.DestPath == "":
+		// Deleted or shredded
+		r.Completed = true
+		r.Reason = fmt.Sprintf("interrupted after %s was removed", op.SourcePath)
+	default:
+		if _, err := os.Lstat(op.DestPath); err != nil {
+			r.Reason = fmt.Sprintf("interrupted; neither %s nor %s exists", op.SourcePath, op.DestPath)
+			break
+		}
+		r.Completed = true
+		r.Reason = fmt.Sprintf("interrupted after moving to %s", op.DestPath)
+		// Moves, trashed and quarantined items can be undone again, as can
+		// redone ones; an undo never can
+		r.Op.Reversible = op.Type == OpMove || op.Type == OpTrash || op.Type == OpQuarantine
+	}
+	r.Op.Metadata["recovered"] = r.Reason
+	return r
+}
+
+func mustJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,123 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDB_BeginCompleteFail(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	op := Operation{Type: OpMove, SourcePath: "/a", DestPath: "/x/a", Reversible: true}
+	id, err := db.Begin(op)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	got, _ := db.Get(id)
+	if got.State != StatePending || got.Reversible || got.Metadata["pid"] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("expected a pending, irreversible intent with our pid, got %+v", got)
+	}
+	if pending, _ := db.Pending(); len(pending) != 1 || pending[0].ID != id {
+		t.Errorf("Pending() = %+v, want operation %d", pending, id)
+	}
+
+	op.FileHash = "abc"
+	if err := db.Complete(id, op); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	got, _ = db.Get(id)
+	if got.State != StateApplied || !got.Reversible || got.FileHash != "abc" {
+		t.Errorf("expected the completed move to be applied and reversible, got %+v", got)
+	}
+	if err := db.Complete(id, op); err == nil {
+		t.Error("expected completing an applied operation to fail")
+	}
+
+	undo, _ := db.Begin(Operation{Type: OpUndo, SourcePath: "/x/a", DestPath: "/a", InverseOf: id})
+	if err := db.Fail(undo, errors.New("disk full")); err != nil {
+		t.Fatalf("Fail() error = %v", err)
+	}
+	got, _ = db.Get(undo)
+	if got.State != StateFailed || got.Metadata["error"] != "disk full" {
+		t.Errorf("expected a failed undo with its error, got %+v", got)
+	}
+	if got, _ := db.Get(id); got.State != StateApplied {
+		t.Errorf("a failed undo changed its target to %s", got.State)
+	}
+}
+
+func TestOpen_RecoversInterruptedOperations(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	touch := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	// A pid far above any kernel's limit belongs to no process
+	dead := map[string]string{"pid": strconv.Itoa(1 << 30)}
+	moved, _ := db.Record(Operation{Type: OpMove, SourcePath: filepath.Join(dir, "gone"), DestPath: touch("moved"),
+		State: StatePending, Metadata: dead})
+	unmoved, _ := db.Record(Operation{Type: OpMove, SourcePath: touch("still-here"), DestPath: filepath.Join(dir, "never"),
+		State: StatePending, Metadata: dead})
+	deleted, _ := db.Record(Operation{Type: OpDelete, SourcePath: filepath.Join(dir, "deleted"),
+		State: StatePending, Metadata: dead})
+	trashed, _ := db.Record(Operation{Type: OpTrash, SourcePath: filepath.Join(dir, "trashed"), DestPath: touch("in-trash"),
+		State: StatePending, Metadata: dead})
+	purgedTrash, _ := db.Record(Operation{Type: OpTrash, SourcePath: filepath.Join(dir, "old"), DestPath: filepath.Join(dir, "purged"),
+		Reversible: true})
+	purge, _ := db.Record(Operation{Type: OpPurge, SourcePath: filepath.Join(dir, "purged"), InverseOf: purgedTrash,
+		State: StatePending, Metadata: dead})
+	running, _ := db.Begin(Operation{Type: OpDelete, SourcePath: touch("in-progress")})
+	db.Close()
+
+	db, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	if n := len(db.Recovered()); n != 5 {
+		t.Fatalf("recovered %d operations, want 5: %+v", n, db.Recovered())
+	}
+	want := map[int64]struct {
+		state      State
+		reversible bool
+	}{
+		moved:   {StateApplied, true},
+		unmoved: {StateFailed, false},
+		deleted: {StateApplied, false},
+		trashed: {StateApplied, true},
+		purge:   {StateApplied, false},
+		running: {StatePending, false},
+	}
+	for id, w := range want {
+		got, err := db.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%d) error = %v", id, err)
+		}
+		if got.State != w.state || got.Reversible != w.reversible {
+			t.Errorf("operation %d is %s, reversible %v; want %s, %v", id, got.State, got.Reversible, w.state, w.reversible)
+		}
+		if id != running && (got.Metadata["recovered"] == "" || got.Metadata["pid"] != "") {
+			t.Errorf("operation %d metadata = %v, want a recovery note and no pid", id, got.Metadata)
+		}
+	}
+	if got, _ := db.Get(purgedTrash); got.Reversible {
+		t.Error("recovering a purge should leave the trash operation it purged irreversible")
+	}
+}
@@ -0,0 +1,252 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations upgrade the schema one version at a time: migrations[i] takes a
+// database from version i to i+1. Append new migrations; never edit or
+// reorder released ones, since existing databases have already applied them.
+var migrations = []string{
+	// 1: the original schema
+	`
+	CREATE TABLE operations (
+		id INTEGER PRIMARY KEY,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		operation TEXT NOT NULL,
+		source_path TEXT NOT NULL,
+		dest_path TEXT,
+		file_size INTEGER,
+		file_hash TEXT,
+		reversible BOOLEAN DEFAULT 0,
+		metadata JSON
+	);
+	CREATE INDEX idx_source ON operations(source_path);
+	CREATE INDEX idx_timestamp ON operations(timestamp);
+	`,
+
+	// 2: batches
+	`
+	ALTER TABLE operations ADD COLUMN batch_id TEXT;
+	CREATE INDEX idx_batch ON operations(batch_id);
+	`,
+
+	// 3: operation states, taken over from the undone_by metadata
+	`
+	ALTER TABLE operations ADD COLUMN state TEXT NOT NULL DEFAULT 'applied';
+	UPDATE operations SET state = 'undone'
+	WHERE json_valid(metadata) AND json_extract(metadata, '$.undone_by') IS NOT NULL;
+	`,
+
+	// 4: links to inverse operations, taken over from the undoes metadata
+	`
+	ALTER TABLE operations ADD COLUMN inverse_of INTEGER;
+	CREATE INDEX idx_inverse ON operations(inverse_of);
+	UPDATE operations SET inverse_of = CAST(json_extract(metadata, '$.undoes') AS INTEGER)
+	WHERE operation = 'undo' AND json_valid(metadata);
+	`,
+
+	// 5: the hash chain, sealing the existing history (see sealAll)
+	`
+	ALTER TABLE operations ADD COLUMN seal_seq INTEGER;
+	ALTER TABLE operations ADD COLUMN digest TEXT;
+	CREATE UNIQUE INDEX idx_seal ON operations(seal_seq);
+	CREATE TABLE pruned_digests (
+		seal_seq INTEGER PRIMARY KEY,
+		digest TEXT NOT NULL
+	);
+	`,
+
+	// 6: full-text search over types, paths and metadata values, kept in
+	// sync by triggers
+	`
+	CREATE VIRTUAL TABLE operations_fts USING fts5(type, source, dest, meta);
+	INSERT INTO operations_fts (rowid, type, source, dest, meta)
+	SELECT id, operation, source_path, IFNULL(dest_path, ''),
+		(SELECT IFNULL(group_concat(value, ' '), '') FROM json_each(CASE WHEN json_valid(metadata) AND json_type(metadata) = 'object' THEN metadata ELSE '{}' END))
+	FROM operations;
+
+	CREATE TRIGGER operations_fts_insert AFTER INSERT ON operations BEGIN
+		INSERT INTO operations_fts (rowid, type, source, dest, meta)
+		VALUES (new.id, new.operation, new.source_path, IFNULL(new.dest_path, ''),
+			(SELECT IFNULL(group_concat(value, ' '), '') FROM json_each(CASE WHEN json_valid(new.metadata) AND json_type(new.metadata) = 'object' THEN new.metadata ELSE '{}' END)));
+	END;
+	CREATE TRIGGER operations_fts_update AFTER UPDATE OF operation, source_path, dest_path, metadata ON operations BEGIN
+		DELETE FROM operations_fts WHERE rowid = old.id;
+		INSERT INTO operations_fts (rowid, type, source, dest, meta)
+		VALUES (new.id, new.operation, new.source_path, IFNULL(new.dest_path, ''),
+			(SELECT IFNULL(group_concat(value, ' '), '') FROM json_each(CASE WHEN json_valid(new.metadata) AND json_type(new.metadata) = 'object' THEN new.metadata ELSE '{}' END)));
+	END;
+	CREATE TRIGGER operations_fts_delete AFTER DELETE ON operations BEGIN
+		DELETE FROM operations_fts WHERE rowid = old.id;
+	END;
+	`,
+
+	// 7: prune records, with one for what was pruned before them (see
+	// recordPrunedBefore)
+	``,
+}
+
+// migrationSteps run after the SQL of the migration to the version they are
+// keyed by, in the same transaction, for what SQL can't express.
+var migrationSteps = map[int]func(tx *sql.Tx) error{
+	5: sealAll,
+	7: recordPrunedBefore,
+}
+
+// migrate brings db up to the latest version, applying each migration and
+// recording its version in one transaction. Other processes may be opening
+// the database at the same time, so each step checks the version again once
+// it holds the write lock.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return err
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		if version, err = adoptUnversioned(db); err != nil {
+			return err
+		}
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("history database is at schema version %d, newer than this breathe supports (%d)", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(db, version+1, migrations[version]); err != nil {
+			return fmt.Errorf("migrating history database to version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, ddl string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil || current >= version {
+		return err
+	}
+	if _, err := tx.Exec(ddl); err != nil {
+		return err
+	}
+	if step := migrationSteps[version]; step != nil {
+		if err := step(tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(q queryer) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// adoptUnversioned records the version of a database created before schema
+// versions were tracked, working it out from the columns that exist. A new
+// database is version 0.
+func adoptUnversioned(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if version, err := schemaVersion(tx); err != nil || version > 0 {
+		return version, err
+	}
+	columns, err := tableColumns(tx, "operations")
+	if err != nil || len(columns) == 0 {
+		return 0, err
+	}
+
+	version := 1
+	for v, column := range map[int]string{2: "batch_id", 3: "state", 4: "inverse_of"} {
+		if columns[column] && v > version {
+			version = v
+		}
+	}
+	for v := 1; v <= version; v++ {
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, v); err != nil {
+			return 0, err
+		}
+	}
+	return version, tx.Commit()
+}
+
+func tableColumns(q queryer, table string) (map[string]bool, error) {
+	rows, err := q.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// CheckResult reports the state of a history database.
+type CheckResult struct {
+	Version   int      `json:"version"`
+	Latest    int      `json:"latest"`
+	Integrity []string `json:"integrity"` // "ok", or the problems SQLite found
+}
+
+// OK reports whether the database is current and intact.
+func (r *CheckResult) OK() bool {
+	return r.Version == r.Latest && len(r.Integrity) == 1 && r.Integrity[0] == "ok"
+}
+
+// Check reports the schema version and runs SQLite's integrity check.
+func (d *DB) Check() (*CheckResult, error) {
+	version, err := schemaVersion(d.db)
+	if err != nil {
+		return nil, err
+	}
+	res := &CheckResult{Version: version, Latest: len(migrations)}
+
+	rows, err := d.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		res.Integrity = append(res.Integrity, msg)
+	}
+	return res, rows.Err()
+}
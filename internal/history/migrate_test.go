@@ -0,0 +1,211 @@
+package history
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// baselineSchema is the schema of databases created before versioning.
+const baselineSchema = `
+	CREATE TABLE operations (
+		id INTEGER PRIMARY KEY,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		operation TEXT NOT NULL,
+		source_path TEXT NOT NULL,
+		dest_path TEXT,
+		file_size INTEGER,
+		file_hash TEXT,
+		reversible BOOLEAN DEFAULT 0,
+		metadata JSON
+	);
+	CREATE INDEX idx_source ON operations(source_path);
+	CREATE INDEX idx_timestamp ON operations(timestamp);
+`
+
+// rawDB creates a database at a new path with the given statements.
+func rawDB(t *testing.T, stmts string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "old.db")
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = raw.Exec(stmts)
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkVersion(t *testing.T, db *DB, want int) {
+	t.Helper()
+	res, err := db.Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if res.Version != want {
+		t.Errorf("schema version = %d, want %d", res.Version, want)
+	}
+}
+
+func TestOpen_UpgradesBaselineDatabase(t *testing.T) {
+	path := rawDB(t, baselineSchema+`
+		INSERT INTO operations (operation, source_path, dest_path) VALUES ('move', '/a', '/b');
+		INSERT INTO operations (operation, source_path, dest_path, metadata) VALUES ('move', '/c', '/d', '{"undone_by": "3"}');
+		INSERT INTO operations (operation, source_path, dest_path, metadata) VALUES ('undo', '/d', '/c', '{"undoes": "2"}');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	checkVersion(t, db, len(migrations))
+
+	op, err := db.Get(1)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if op.SourcePath != "/a" || op.BatchID != "" || op.State != StateApplied {
+		t.Errorf("unexpected migrated operation %+v", op)
+	}
+	if undone, _ := db.Get(2); undone.State != StateUndone {
+		t.Errorf("expected undone_by metadata to migrate to state, got %s", undone.State)
+	}
+	if undo, _ := db.Get(3); undo.InverseOf != 2 {
+		t.Errorf("expected undoes metadata to migrate to inverse_of, got %d", undo.InverseOf)
+	}
+	if ops, _ := db.Search("source:c"); len(ops) != 1 || ops[0].ID != 2 {
+		t.Errorf("expected existing operations to be indexed for search, got %v", ops)
+	}
+	if _, err := db.Record(Operation{Type: OpMove, SourcePath: "/c", BatchID: NewBatchID()}); err != nil {
+		t.Errorf("Record() after migration error = %v", err)
+	}
+	// The existing history was sealed, and new operations extend the chain
+	if res, err := db.Verify(); err != nil || res.Broken != nil || res.Sealed != 4 {
+		t.Errorf("Verify() = %+v, %v; want 4 sealed operations", res, err)
+	}
+}
+
+func TestOpen_RecordsEarlierPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	old, _ := db.Record(Operation{Type: OpDelete, SourcePath: "/old"})
+	db.Record(Operation{Type: OpDelete, SourcePath: "/new"})
+	// Prune as it worked at version 6, without a prune record
+	db.db.Exec(`INSERT INTO pruned_digests SELECT seal_seq, digest FROM operations WHERE id = ?`, old)
+	db.db.Exec(`DELETE FROM operations WHERE id = ?`, old)
+	db.db.Exec(`DELETE FROM schema_version WHERE version = 7`)
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	checkVersion(t, db, len(migrations))
+
+	if ops, _ := db.Query(Filter{Types: []OpType{OpPrune}}); len(ops) != 1 || ops[0].Metadata["pruned"] != "1" {
+		t.Errorf("expected a prune record for #1, got %+v", ops)
+	}
+	if res, err := db.Verify(); err != nil || res.Broken != nil || res.Sealed != 3 {
+		t.Errorf("Verify() = %+v, %v; want 3 sealed operations", res, err)
+	}
+}
+
+func TestOpen_AdoptsUnversionedDatabase(t *testing.T) {
+	// Batches were added before schema versions were tracked
+	path := rawDB(t, baselineSchema+`
+		ALTER TABLE operations ADD COLUMN batch_id TEXT;
+		INSERT INTO operations (operation, source_path, batch_id) VALUES ('delete', '/a', 'b1');
+	`)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	checkVersion(t, db, len(migrations))
+
+	if ops, _ := db.Batch("b1"); len(ops) != 1 {
+		t.Errorf("expected the batch to survive, got %v", ops)
+	}
+}
+
+func TestOpen_IsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	for i := 0; i < 2; i++ {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() #%d error = %v", i+1, err)
+		}
+		checkVersion(t, db, len(migrations))
+		db.Close()
+	}
+}
+
+func TestOpen_FailedMigrationRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	db.Close()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+	migrations = append(migrations[:len(saved):len(saved)], `
+		ALTER TABLE operations ADD COLUMN extra TEXT;
+		INSERT INTO missing_table VALUES (1);
+	`)
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	migrations = saved
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	checkVersion(t, db, len(saved))
+	if columns, _ := tableColumns(db.db, "operations"); columns["extra"] {
+		t.Error("the failed migration's column should be rolled back")
+	}
+}
+
+func TestOpen_RefusesNewerDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	db.db.Exec(`INSERT INTO schema_version (version) VALUES (?)`, len(migrations)+1)
+	db.Close()
+
+	if _, err := Open(path); err == nil {
+		t.Error("expected an error for a database from a newer version")
+	}
+}
+
+func TestDB_Check(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	res, err := db.Check()
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !res.OK() {
+		t.Errorf("expected a fresh database to check out, got %+v", res)
+	}
+}
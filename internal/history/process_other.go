@@ -0,0 +1,11 @@
+//go:build !unix
+
+package history
+
+import "os"
+
+// processAlive reports whether a process with the given ID is running.
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,130 @@
+package history
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PruneOptions selects what Prune removes.
+type PruneOptions struct {
+	Before         time.Time // Delete operations recorded before this; zero deletes none
+	KeepReversible bool      // Keep old trash and quarantine operations whose item is still there
+	Orphans        bool      // Mark operations whose item is gone as no longer reversible
+	DryRun         bool      // Report without changing anything
+}
+
+// PruneResult reports what Prune removed or would remove.
+type PruneResult struct {
+	Pruned  int
+	Orphans []Operation
+}
+
+// Prune deletes old operations and retires orphaned ones in one transaction.
+// An orphan is a reversible operation whose DestPath no longer exists, for
+// example because the trash was emptied outside breathe; it can't be undone,
+// so its record only keeps old operations from being pruned.
+func (d *DB) Prune(opts PruneOptions) (*PruneResult, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT ` + opColumns + ` FROM operations WHERE reversible = 1 ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	reversible, err := scanOperations(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &PruneResult{}
+	var keep []string
+	for _, op := range reversible {
+		if _, err := os.Lstat(op.DestPath); err != nil {
+			if opts.Orphans {
+				res.Orphans = append(res.Orphans, op)
+			}
+			continue
+		}
+		// Moved files are where the user put them, not waiting to be purged
+		if opts.KeepReversible && (op.Type == OpTrash || op.Type == OpQuarantine) {
+			keep = append(keep, strconv.FormatInt(op.ID, 10))
+		}
+	}
+
+	for _, op := range res.Orphans {
+		_, err := tx.Exec(`
+			UPDATE operations
+			SET reversible = 0,
+				metadata = json_set(CASE WHEN json_valid(metadata) AND json_type(metadata) = 'object' THEN metadata ELSE '{}' END, '$.orphaned', ?)
+			WHERE id = ?
+		`, formatTimestamp(time.Now()), op.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.Before.IsZero() {
+		// Pending operations may still be completed or recovered, and prune
+		// records vouch for what was pruned before
+		where := `timestamp < ? AND state != 'pending' AND operation != 'prune'`
+		if len(keep) > 0 {
+			// IDs come from the database, so they are safe to inline
+			where += ` AND id NOT IN (` + strings.Join(keep, ",") + `)`
+		}
+		before := formatTimestamp(opts.Before)
+		rows, err := tx.Query(`SELECT seal_seq FROM operations WHERE seal_seq IS NOT NULL AND `+where+` ORDER BY seal_seq`, before)
+		if err != nil {
+			return nil, err
+		}
+		var seqs []int64
+		for rows.Next() {
+			var seq int64
+			if err := rows.Scan(&seq); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			seqs = append(seqs, seq)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// Keep the digests of pruned operations so the hash chain still
+		// verifies, and seal a record of which ones were pruned
+		if _, err := tx.Exec(`
+			INSERT INTO pruned_digests (seal_seq, digest)
+			SELECT seal_seq, digest FROM operations WHERE seal_seq IS NOT NULL AND `+where, before); err != nil {
+			return nil, err
+		}
+		result, err := tx.Exec(`DELETE FROM operations WHERE `+where, before)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		res.Pruned = int(n)
+		if err := recordPrune(tx, seqs); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.DryRun {
+		return res, nil
+	}
+	return res, tx.Commit()
+}
+
+// Vacuum rebuilds the database file to return space freed by Prune.
+func (d *DB) Vacuum() error {
+	_, err := d.db.Exec(`VACUUM`)
+	return err
+}
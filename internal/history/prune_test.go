@@ -0,0 +1,71 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Prune(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := Open(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	trashed := filepath.Join(tmpDir, "trashed")
+	os.WriteFile(trashed, []byte("x"), 0644)
+
+	old, _ := db.Record(Operation{Type: OpDelete, SourcePath: "/old"})
+	kept, _ := db.Record(Operation{Type: OpTrash, SourcePath: "/kept", DestPath: trashed, Reversible: true})
+	orphan, _ := db.Record(Operation{Type: OpTrash, SourcePath: "/gone", DestPath: filepath.Join(tmpDir, "gone"), Reversible: true})
+	moved, _ := db.Record(Operation{Type: OpMove, SourcePath: "/moved", DestPath: trashed, Reversible: true})
+	db.db.Exec(`UPDATE operations SET timestamp = ?`, formatTimestamp(time.Now().AddDate(0, 0, -100)))
+	recent, _ := db.Record(Operation{Type: OpDelete, SourcePath: "/recent"})
+
+	opts := PruneOptions{Before: time.Now().AddDate(0, 0, -30), KeepReversible: true, Orphans: true, DryRun: true}
+	res, err := db.Prune(opts)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if res.Pruned != 3 || len(res.Orphans) != 1 || res.Orphans[0].ID != orphan {
+		t.Errorf("unexpected dry run result %+v", res)
+	}
+	if _, err := db.Get(old); err != nil {
+		t.Error("dry run should not delete anything")
+	}
+
+	opts.DryRun = false
+	if _, err := db.Prune(opts); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	for id, want := range map[int64]bool{old: false, kept: true, orphan: false, moved: false, recent: true} {
+		if _, err := db.Get(id); (err == nil) != want {
+			t.Errorf("operation %d kept = %v, want %v", id, err == nil, want)
+		}
+	}
+
+	if err := db.Vacuum(); err != nil {
+		t.Errorf("Vacuum() error = %v", err)
+	}
+}
+
+func TestDB_PruneMarksOrphans(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	id, _ := db.Record(Operation{Type: OpMove, SourcePath: "/a", DestPath: "/nonexistent/a", Reversible: true})
+	if _, err := db.Prune(PruneOptions{Orphans: true}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	op, _ := db.Get(id)
+	if op.Reversible || op.Metadata["orphaned"] == "" {
+		t.Errorf("expected orphan to be retired, got %+v", op)
+	}
+}
@@ -0,0 +1,167 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// matchFields maps the field names of the search syntax to columns of
+// operations_fts.
+var matchFields = map[string]string{
+	"type":   "type",
+	"source": "source",
+	"dest":   "dest",
+	"path":   "{source dest}",
+	"meta":   "meta",
+}
+
+// ParseMatch translates a search query into an FTS5 expression. Paths are
+// split into words at slashes, dots and other punctuation. Terms must all
+// match unless joined by OR:
+//
+//	report          the word in any path, metadata value or the type
+//	"old reports"   the phrase
+//	rep*            a word starting with rep
+//	path:downloads  only in a field: type, source, dest, path (source or
+//	                dest) or meta (metadata values, such as original_name)
+func ParseMatch(query string) (string, error) {
+	var terms []string
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		var term string
+		var err error
+		term, rest, err = parseTerm(rest)
+		if err != nil {
+			return "", err
+		}
+		if term != "" {
+			terms = append(terms, term)
+		}
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+
+	// Drop dangling ORs so they don't make the expression invalid
+	for len(terms) > 0 && terms[0] == "OR" {
+		terms = terms[1:]
+	}
+	for len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	if len(terms) == 0 {
+		return "", fmt.Errorf("empty search query")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// parseTerm parses the term at the start of s and returns it as FTS5 along
+// with the rest of s.
+func parseTerm(s string) (term, rest string, err error) {
+	column := ""
+	if i := strings.IndexByte(s, ':'); i > 0 {
+		if c, ok := matchFields[strings.ToLower(s[:i])]; ok {
+			column, s = c+" : ", s[i+1:]
+		}
+	}
+
+	var text string
+	if strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated phrase in search query")
+		}
+		text, rest = s[1:end+1], s[end+2:]
+	} else {
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		text, rest = s[:end], s[end:]
+		if column == "" && text == "OR" {
+			return "OR", rest, nil
+		}
+	}
+
+	prefix := ""
+	if strings.HasPrefix(rest, "*") {
+		prefix, rest = "*", rest[1:]
+	} else if strings.HasSuffix(text, "*") {
+		prefix, text = "*", strings.TrimSuffix(text, "*")
+	}
+	if !strings.ContainsFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+		// Nothing the tokenizer would index, such as a lone slash
+		return "", rest, nil
+	}
+	return column + `"` + strings.ReplaceAll(text, `"`, `""`) + `"` + prefix, rest, nil
+}
+
+// Hit is an operation found by a full-text query, with the matching words in
+// its paths and metadata values wrapped in the markers passed to Hits.
+type Hit struct {
+	Operation
+	Source string
+	Dest   string
+	Meta   string // Excerpt of the metadata values, if they matched
+}
+
+// Hits runs Query and highlights where each operation matched f.Match, which
+// must be set.
+func (d *DB) Hits(f Filter, open, close string) ([]Hit, error) {
+	if f.Match == "" {
+		return nil, fmt.Errorf("no search query")
+	}
+	ops, err := d.Query(f)
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+	expr, err := ParseMatch(f.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(ops))
+	for i, op := range ops {
+		ids[i] = strconv.FormatInt(op.ID, 10)
+	}
+	// IDs come from the database, so they are safe to inline
+	// highlight leaves a column as it is unless it matched, which tells
+	// whether the metadata did without relying on what the markers look like
+	rows, err := d.db.Query(`
+		SELECT rowid, highlight(operations_fts, 1, ?1, ?2), highlight(operations_fts, 2, ?1, ?2),
+			snippet(operations_fts, 3, ?1, ?2, '…', 12), highlight(operations_fts, 3, ?1, ?2) != meta
+		FROM operations_fts
+		WHERE operations_fts MATCH ?3 AND rowid IN (`+strings.Join(ids, ",")+`)
+	`, open, close, expr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type marked struct {
+		source, dest, meta string
+		metaMatched        bool
+	}
+	highlights := make(map[int64]marked)
+	for rows.Next() {
+		var id int64
+		var m marked
+		if err := rows.Scan(&id, &m.source, &m.dest, &m.meta, &m.metaMatched); err != nil {
+			return nil, err
+		}
+		highlights[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(ops))
+	for i, op := range ops {
+		m := highlights[op.ID]
+		hits[i] = Hit{Operation: op, Source: m.source, Dest: m.dest}
+		if m.metaMatched {
+			hits[i].Meta = m.meta
+		}
+	}
+	return hits, nil
+}
@@ -0,0 +1,117 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMatch(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`report`, `"report"`},
+		{`report.pdf`, `"report.pdf"`},
+		{`"old reports" 2024`, `"old reports" "2024"`},
+		{`rep*`, `"rep"*`},
+		{`"old rep"*`, `"old rep"*`},
+		{`path:downloads type:move`, `{source dest} : "downloads" type : "move"`},
+		{`meta:"my file"`, `meta : "my file"`},
+		{`c:\temp`, `"c:\temp"`},
+		{`a OR b`, `"a" OR "b"`},
+		{`OR a OR`, `"a"`},
+		{`say "hi""`, ``},
+		{`a / b`, `"a" "b"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseMatch(tt.query)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseMatch(%q) = %q, want an error", tt.query, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMatch(%q) = %q, %v; want %q", tt.query, got, err, tt.want)
+		}
+	}
+	if _, err := ParseMatch("  / "); err == nil {
+		t.Error("expected an empty query to be rejected")
+	}
+}
+
+func TestDB_Search(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	moved, _ := db.Record(Operation{Type: OpMove, SourcePath: "/home/u/Downloads/Q3 report.pdf", DestPath: "/home/u/Documents/Q3 report.pdf",
+		Metadata: map[string]string{"original_name": "Q3 report.pdf"}})
+	trashed, _ := db.Record(Operation{Type: OpTrash, SourcePath: "/home/u/reports/old", DestPath: "/trash/old"})
+	pending, _ := db.Begin(Operation{Type: OpMove, SourcePath: "/home/u/Downloads/notes.txt"})
+
+	search := func(query string) []int64 {
+		t.Helper()
+		ops, err := db.Search(query)
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", query, err)
+		}
+		var ids []int64
+		for _, op := range ops {
+			ids = append(ids, op.ID)
+		}
+		return ids
+	}
+
+	if ids := search("report"); len(ids) != 1 || ids[0] != moved {
+		t.Errorf("Search(report) = %v, want [%d]", ids, moved)
+	}
+	if ids := search("report*"); len(ids) != 2 || ids[0] != moved {
+		t.Errorf("Search(report*) = %v, want %d ranked first of two", ids, moved)
+	}
+	if ids := search(`"q3 report"`); len(ids) != 1 {
+		t.Errorf("phrase search = %v", ids)
+	}
+	if ids := search("meta:q3"); len(ids) != 1 || ids[0] != moved {
+		t.Errorf("metadata search = %v", ids)
+	}
+	if ids := search("dest:downloads"); len(ids) != 0 {
+		t.Errorf("dest search found the source: %v", ids)
+	}
+	if ids := search("type:trash"); len(ids) != 1 || ids[0] != trashed {
+		t.Errorf("type search = %v", ids)
+	}
+
+	// The index follows updates and deletes
+	db.Complete(pending, Operation{Type: OpMove, SourcePath: "/home/u/Downloads/notes.txt", DestPath: "/home/u/Archive/notes.txt",
+		Metadata: map[string]string{"original_name": "notes.txt"}})
+	if ids := search("archive meta:notes"); len(ids) != 1 || ids[0] != pending {
+		t.Errorf("search after Complete = %v, want [%d]", ids, pending)
+	}
+	db.db.Exec(`DELETE FROM operations WHERE id = ?`, trashed)
+	if ids := search("type:trash"); len(ids) != 0 {
+		t.Errorf("deleted operation still found: %v", ids)
+	}
+
+	hits, err := db.Hits(Filter{Match: "report", Types: []OpType{OpMove}}, "<", ">")
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Hits() = %v, %v", hits, err)
+	}
+	if h := hits[0]; h.Source != "/home/u/Downloads/Q3 <report>.pdf" || h.Meta != "Q3 <report>.pdf" {
+		t.Errorf("unexpected highlights %q, %q", h.Source, h.Meta)
+	}
+	// Metadata that contains the markers itself didn't match
+	db.Record(Operation{Type: OpShred, SourcePath: "/home/u/secrets", Metadata: map[string]string{"manifest": `[{"path":"/home/u/secrets/a"}]`}})
+	hits, err = db.Hits(Filter{Match: "secrets", Types: []OpType{OpShred}}, "[", "]")
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Hits() = %v, %v", hits, err)
+	}
+	if h := hits[0]; h.Source != "/home/u/[secrets]" || h.Meta == "" {
+		t.Errorf("unexpected highlights %q, %q", h.Source, h.Meta)
+	}
+	hits, _ = db.Hits(Filter{Match: "source:secrets", Types: []OpType{OpShred}}, "[", "]")
+	if len(hits) != 1 || hits[0].Meta != "" {
+		t.Errorf("metadata reported as matching a source-only query: %+v", hits)
+	}
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Period is the bucket size for Stats.ByPeriod.
+type Period string
+
+const (
+	PeriodDay  Period = "day"
+	PeriodWeek Period = "week"
+)
+
+// key returns the bucket t falls into, in local time: "2006-01-02" for days
+// and ISO weeks like "2006-W01".
+func (p Period) key(t time.Time) string {
+	t = t.Local()
+	if p == PeriodWeek {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01-02")
+}
+
+// Stats summarizes operations. Reclaimed space counts only operations that
+// freed it for good: deletes, shreds and purges from the trash or quarantine.
+type Stats struct {
+	Reclaimed  int64      `json:"reclaimed"`
+	Operations int        `json:"operations"` // Operations that reclaimed space
+	ByPeriod   []StatsRow `json:"by_period"`  // Reclaimed space, oldest first
+	ByType     []StatsRow `json:"by_type"`    // Every operation, largest first
+	ByGroup    []StatsRow `json:"by_group"`   // Reclaimed space, largest first
+}
+
+type StatsRow struct {
+	Key        string `json:"key"`
+	Operations int    `json:"operations"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// Reclaims reports whether an operation of type t frees space permanently.
+func Reclaims(t OpType) bool {
+	return t == OpDelete || t == OpShred || t == OpPurge
+}
+
+// Summarize computes stats over ops. group names the junk group of an
+// operation, or "" for none; failed and pending operations are ignored.
+func Summarize(ops []Operation, period Period, group func(Operation) string) Stats {
+	var s Stats
+	byPeriod := make(map[string]*StatsRow)
+	byType := make(map[string]*StatsRow)
+	byGroup := make(map[string]*StatsRow)
+	tally := func(rows map[string]*StatsRow, key string, size int64) {
+		r := rows[key]
+		if r == nil {
+			r = &StatsRow{Key: key}
+			rows[key] = r
+		}
+		r.Operations++
+		r.Bytes += size
+	}
+
+	for _, op := range ops {
+		if op.State == StateFailed || op.State == StatePending {
+			continue
+		}
+		tally(byType, string(op.Type), op.FileSize)
+		if !Reclaims(op.Type) {
+			continue
+		}
+
+		s.Reclaimed += op.FileSize
+		s.Operations++
+		tally(byPeriod, period.key(op.Timestamp), op.FileSize)
+		g := group(op)
+		if g == "" {
+			g = "other"
+		}
+		tally(byGroup, g, op.FileSize)
+	}
+
+	s.ByPeriod = sortedRows(byPeriod, func(a, b StatsRow) bool { return a.Key < b.Key })
+	s.ByType = sortedRows(byType, largestFirst)
+	s.ByGroup = sortedRows(byGroup, largestFirst)
+	return s
+}
+
+func largestFirst(a, b StatsRow) bool {
+	if a.Bytes != b.Bytes {
+		return a.Bytes > b.Bytes
+	}
+	return a.Key < b.Key
+}
+
+func sortedRows(rows map[string]*StatsRow, less func(a, b StatsRow) bool) []StatsRow {
+	sorted := make([]StatsRow, 0, len(rows))
+	for _, r := range rows {
+		sorted = append(sorted, *r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
@@ -0,0 +1,43 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local) // A Monday
+	ops := []Operation{
+		{Type: OpDelete, SourcePath: "/p/node_modules", FileSize: 100, Timestamp: day},
+		{Type: OpShred, SourcePath: "/p/secret.txt", FileSize: 10, Timestamp: day.AddDate(0, 0, 1)},
+		{Type: OpPurge, SourcePath: "/t/dist", FileSize: 50, Timestamp: day.AddDate(0, 0, 7)},
+		{Type: OpTrash, SourcePath: "/p/old", FileSize: 1000, Timestamp: day},
+		{Type: OpUndo, SourcePath: "/t/x", FileSize: 5, Timestamp: day, State: StateFailed},
+	}
+	group := func(op Operation) string {
+		if filepath.Base(op.SourcePath) == "node_modules" {
+			return "node_modules"
+		}
+		return ""
+	}
+
+	s := Summarize(ops, PeriodWeek, group)
+	if s.Reclaimed != 160 || s.Operations != 3 {
+		t.Errorf("reclaimed %d in %d operations, want 160 in 3", s.Reclaimed, s.Operations)
+	}
+
+	if len(s.ByPeriod) != 2 || s.ByPeriod[0].Key != "2026-W10" || s.ByPeriod[0].Bytes != 110 {
+		t.Errorf("unexpected weeks %+v", s.ByPeriod)
+	}
+	if len(s.ByType) != 4 || s.ByType[0].Key != "trash" {
+		t.Errorf("expected trash first and failed operations ignored, got %+v", s.ByType)
+	}
+	if len(s.ByGroup) != 2 || s.ByGroup[0] != (StatsRow{"node_modules", 1, 100}) || s.ByGroup[1].Key != "other" {
+		t.Errorf("unexpected groups %+v", s.ByGroup)
+	}
+
+	if days := Summarize(ops, PeriodDay, group).ByPeriod; len(days) != 3 || days[0].Key != "2026-03-02" {
+		t.Errorf("unexpected days %+v", days)
+	}
+}
@@ -0,0 +1,32 @@
+// Package openfiles finds processes that hold files open, using /proc where
+// available. On other platforms every query reports nothing.
+package openfiles
+
+import "fmt"
+
+// Holder is a process using a path, either through an open file descriptor
+// or as its working directory.
+type Holder struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Path    string `json:"path"`
+	Cwd     bool   `json:"cwd,omitempty"`
+}
+
+func (h Holder) String() string {
+	how := "has open"
+	if h.Cwd {
+		how = "is running in"
+	}
+	return fmt.Sprintf("pid %d (%s) %s %s", h.PID, h.Command, how, h.Path)
+}
+
+// DeletedFile is a file that has been unlinked but is still held open, so its
+// space is not freed until the process closes it or exits.
+type DeletedFile struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	FD      int    `json:"fd"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+}
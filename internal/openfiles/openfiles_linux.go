@@ -0,0 +1,126 @@
+package openfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procRoot is a variable so tests can point it at a fake /proc.
+var procRoot = "/proc"
+
+const deletedSuffix = " (deleted)"
+
+// Under returns processes other than this one that have files open, or their
+// working directory, at or below path.
+func Under(path string) ([]Holder, error) {
+	path = filepath.Clean(path)
+
+	var holders []Holder
+	err := eachProcess(func(pid int, dir string) {
+		if cwd, err := os.Readlink(filepath.Join(dir, "cwd")); err == nil && within(cwd, path) {
+			holders = append(holders, Holder{PID: pid, Command: command(dir), Path: cwd, Cwd: true})
+		}
+
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			return // Process exited or belongs to another user
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !within(target, path) {
+				continue
+			}
+			holders = append(holders, Holder{PID: pid, Command: command(dir), Path: target})
+		}
+	})
+	return holders, err
+}
+
+// Deleted returns unlinked files still held open whose original path was at
+// or below root. Each file is reported once even if several descriptors
+// refer to it.
+func Deleted(root string) ([]DeletedFile, error) {
+	root = filepath.Clean(root)
+
+	type inode struct{ dev, ino uint64 }
+	seen := make(map[inode]bool)
+
+	var files []DeletedFile
+	err := eachProcess(func(pid int, dir string) {
+		fdDir := filepath.Join(dir, "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			return
+		}
+		for _, fd := range fds {
+			link := filepath.Join(fdDir, fd.Name())
+			target, err := os.Readlink(link)
+			if err != nil || !strings.HasSuffix(target, deletedSuffix) {
+				continue
+			}
+			target = strings.TrimSuffix(target, deletedSuffix)
+			if !within(target, root) {
+				continue
+			}
+
+			// Stat through the fd link reaches the unlinked inode
+			var size int64
+			if info, err := os.Stat(link); err == nil {
+				if !info.Mode().IsRegular() {
+					continue
+				}
+				size = info.Size()
+				if st, ok := info.Sys().(*syscall.Stat_t); ok {
+					key := inode{uint64(st.Dev), uint64(st.Ino)}
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+			}
+
+			n, _ := strconv.Atoi(fd.Name())
+			files = append(files, DeletedFile{PID: pid, Command: command(dir), FD: n, Path: target, Size: size})
+		}
+	})
+	return files, err
+}
+
+func eachProcess(fn func(pid int, dir string)) error {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	self := os.Getpid()
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		fn(pid, filepath.Join(procRoot, e.Name()))
+	}
+	return nil
+}
+
+func command(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return "?"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	if path == dir || dir == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
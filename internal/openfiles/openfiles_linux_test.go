@@ -0,0 +1,72 @@
+package openfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeProc builds a /proc-like tree with one process and points procRoot at it.
+func fakeProc(t *testing.T, pid int, comm, cwd string, fds ...string) {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	os.MkdirAll(filepath.Join(dir, "fd"), 0755)
+	os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644)
+	os.Symlink(cwd, filepath.Join(dir, "cwd"))
+	for i, target := range fds {
+		os.Symlink(target, filepath.Join(dir, "fd", strconv.Itoa(i+3)))
+	}
+
+	old := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = old })
+}
+
+func TestUnder_FindsOpenFilesAndCwd(t *testing.T) {
+	fakeProc(t, 4242, "postgres", "/srv/db", "/srv/db/base/1234", "/var/log/pg.log")
+
+	holders, err := Under("/srv/db")
+	if err != nil {
+		t.Fatalf("Under() error = %v", err)
+	}
+	if len(holders) != 2 {
+		t.Fatalf("expected 2 holders, got %v", holders)
+	}
+	for _, h := range holders {
+		if h.PID != 4242 || h.Command != "postgres" {
+			t.Errorf("unexpected holder %+v", h)
+		}
+	}
+
+	holders, _ = Under("/srv/dbx")
+	if len(holders) != 0 {
+		t.Errorf("expected no holders for sibling path, got %v", holders)
+	}
+}
+
+func TestDeleted_ReportsUnlinkedFiles(t *testing.T) {
+	fakeProc(t, 7, "nginx", "/", "/var/log/nginx/access.log (deleted)", "/var/log/nginx/error.log", "/tmp/x (deleted)")
+
+	files, err := Deleted("/var/log")
+	if err != nil {
+		t.Fatalf("Deleted() error = %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 deleted file, got %v", files)
+	}
+	if files[0].Path != "/var/log/nginx/access.log" || files[0].FD != 3 || files[0].Command != "nginx" {
+		t.Errorf("unexpected deleted file %+v", files[0])
+	}
+}
+
+func TestDeleted_RealProcFS(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("no /proc")
+	}
+	// Only checks that reading the real /proc doesn't fail
+	if _, err := Deleted("/"); err != nil {
+		t.Errorf("Deleted() error = %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package openfiles
+
+// Under is not supported on this platform and reports no holders.
+func Under(path string) ([]Holder, error) {
+	return nil, nil
+}
+
+// Deleted is not supported on this platform and reports no files.
+func Deleted(root string) ([]DeletedFile, error) {
+	return nil, nil
+}
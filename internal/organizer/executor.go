@@ -2,33 +2,55 @@ package organizer
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
 	"github.com/0xjjjjjj/breathe/internal/history"
 )
 
 type Executor struct {
-	db     *history.DB
-	dryRun bool
+	db          *history.DB
+	dryRun      bool
+	mover       *fsutil.Mover
+	batchID     string
+	requireHist bool
 }
 
 func NewExecutor(db *history.DB, dryRun bool) *Executor {
-	return &Executor{db: db, dryRun: dryRun}
+	return &Executor{db: db, dryRun: dryRun, mover: fsutil.NewMover()}
 }
 
+// SetRequireHistory makes Execute stop when it can't record the intent of a
+// move before making it.
+func (e *Executor) SetRequireHistory(require bool) {
+	e.requireHist = require
+}
+
+// Execute moves every file in plan, recording all moves under one new batch.
 func (e *Executor) Execute(plan *Plan) error {
+	e.batchID = history.NewBatchID()
 	for _, fp := range plan.Files {
 		if err := e.moveFile(fp); err != nil {
+			// The move itself happened; stop before making more that can't be undone
+			if errors.Is(err, history.ErrNotRecorded) {
+				return err
+			}
 			return fmt.Errorf("failed to move %s: %w", fp.Source, err)
 		}
 	}
 	return nil
 }
 
+// BatchID returns the batch of the last Execute run.
+func (e *Executor) BatchID() string {
+	return e.batchID
+}
+
 func (e *Executor) moveFile(fp FilePlan) error {
 	// Ensure destination directory exists
 	destDir := filepath.Dir(fp.Dest)
@@ -54,26 +76,57 @@ func (e *Executor) moveFile(fp FilePlan) error {
 
 	// Calculate hash before move
 	hash, _ := fileHash(fp.Source)
+	op := history.Operation{
+		Type:       history.OpMove,
+		SourcePath: fp.Source,
+		DestPath:   dest,
+		FileSize:   fp.Size,
+		FileHash:   hash,
+		Metadata:   map[string]string{"original_name": filepath.Base(fp.Source)},
+		BatchID:    e.batchID,
+	}
 
-	// Move file
-	if err := os.Rename(fp.Source, dest); err != nil {
+	// Record the intent first, so an interrupted move can be recovered
+	var intent int64
+	var intentErr error
+	if e.db != nil {
+		intent, intentErr = e.db.Begin(op)
+	}
+	if e.requireHist {
+		if e.db == nil {
+			return fmt.Errorf("history is unavailable")
+		}
+		if intentErr != nil {
+			return fmt.Errorf("history is not writable: %w", intentErr)
+		}
+	}
+
+	// Move file (copies across filesystems). A partial move still put the
+	// file at dest, so it is recorded before the error is returned.
+	err := e.mover.Move(fp.Source, dest)
+	var partial *fsutil.PartialMoveError
+	if err != nil && !errors.As(err, &partial) {
+		if intent != 0 {
+			e.db.Fail(intent, err)
+		}
 		return err
 	}
 
 	// Record in history
 	if e.db != nil {
-		e.db.Record(history.Operation{
-			Type:       history.OpMove,
-			SourcePath: fp.Source,
-			DestPath:   dest,
-			FileSize:   fp.Size,
-			FileHash:   hash,
-			Reversible: true,
-			Metadata:   map[string]string{"original_name": filepath.Base(fp.Source)},
-		})
+		op.Reversible = true
+		var rerr error
+		if intent != 0 {
+			rerr = e.db.Complete(intent, op)
+		} else {
+			_, rerr = e.db.Record(op)
+		}
+		if rerr != nil {
+			return &history.NotRecordedError{Op: op, Err: rerr}
+		}
 	}
 
-	return nil
+	return err
 }
 
 func fileHash(path string) (string, error) {
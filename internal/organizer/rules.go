@@ -91,10 +91,7 @@ func (m *RuleMatcher) CreatePlan(sourcePath string) (*Plan, error) {
 		}
 
 		// Expand ~ to home directory
-		if strings.HasPrefix(dest, "~") {
-			home, _ := os.UserHomeDir()
-			dest = filepath.Join(home, dest[1:])
-		}
+		dest = config.ExpandHome(dest)
 
 		fp := FilePlan{
 			Source: filepath.Join(sourcePath, e.Name()),
@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Candidate is a safe junk path that can be deleted to free space.
+type Candidate struct {
+	Path      string    `json:"path"`
+	Group     string    `json:"group"`
+	Size      int64     `json:"size"`
+	Modified  time.Time `json:"modified"`
+	Stale     bool      `json:"stale"`
+	RegenCost float64   `json:"regen_cost"`
+}
+
+// buildOutputDirs are directory names that hold regenerable output inside a
+// project but are just as often tool or user directories, like ~/go/bin.
+var buildOutputDirs = map[string]bool{
+	"bin": true, "obj": true, "dist": true, "build": true, "out": true, ".next": true, ".nuxt": true,
+}
+
+// projectMarkers are the files that show a directory is a project whose
+// build output can be regenerated.
+var projectMarkers = []string{"package.json", "*.csproj", "*.fsproj", "*.vbproj", "*.sln"}
+
+// BudgetOptions controls how candidates are ranked.
+type BudgetOptions struct {
+	StaleAfter time.Duration // Untouched for this long means stale
+	WeighCost  bool          // Rank by size per unit of regeneration cost
+	Now        time.Time     // Defaults to time.Now()
+}
+
+// Candidates returns the paths of every safe junk group, ranked for freeing
+// space: stale before active, then largest first (or, with WeighCost, most
+// bytes per unit of regeneration cost first). A build output directory is
+// only a candidate when its parent has a project marker.
+func (c *JunkCollector) Candidates(opts BudgetOptions) []Candidate {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var candidates []Candidate
+	seen := make(map[string]bool)
+	for _, g := range c.Groups() {
+		if !g.Safe {
+			continue
+		}
+		for _, path := range g.Paths {
+			// A path matching several patterns is offered once
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if buildOutputDirs[filepath.Base(path)] && !hasProjectMarker(filepath.Dir(path)) {
+				continue
+			}
+
+			modified := c.Modified(path)
+			candidates = append(candidates, Candidate{
+				Path:      path,
+				Group:     g.Name,
+				Size:      nodeSize(c.tree, path),
+				Modified:  modified,
+				Stale:     now.Sub(modified) >= opts.StaleAfter,
+				RegenCost: c.matcher.RegenCost(g.Name),
+			})
+		}
+	}
+
+	score := func(cand Candidate) float64 {
+		if opts.WeighCost {
+			return float64(cand.Size) / cand.RegenCost
+		}
+		return float64(cand.Size)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Stale != candidates[j].Stale {
+			return candidates[i].Stale
+		}
+		if si, sj := score(candidates[i]), score(candidates[j]); si != sj {
+			return si > sj
+		}
+		return candidates[i].Path < candidates[j].Path
+	})
+	return candidates
+}
+
+func hasProjectMarker(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		for _, marker := range projectMarkers {
+			if ok, _ := filepath.Match(marker, e.Name()); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SelectBudget picks candidates in rank order until they add up to need
+// bytes, then drops picks the target is still reached without, least
+// preferred first, so the plan deletes nothing it doesn't have to. It returns
+// the selection in rank order and its total size, which is less than need if
+// all candidates together are not enough.
+func SelectBudget(candidates []Candidate, need int64) ([]Candidate, int64) {
+	var selected []Candidate
+	var total int64
+	for _, cand := range candidates {
+		if total >= need {
+			break
+		}
+		if cand.Size == 0 {
+			continue
+		}
+		selected = append(selected, cand)
+		total += cand.Size
+	}
+	if total < need {
+		return selected, total
+	}
+
+	drop := make([]bool, len(selected))
+	for i := len(selected) - 1; i >= 0; i-- {
+		if total-selected[i].Size >= need {
+			drop[i] = true
+			total -= selected[i].Size
+		}
+	}
+
+	kept := selected[:0]
+	for i, cand := range selected {
+		if !drop[i] {
+			kept = append(kept, cand)
+		}
+	}
+	return kept, total
+}
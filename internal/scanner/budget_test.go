@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+func TestJunkCollector_Candidates(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, -3, 0)
+	recent := now.AddDate(0, 0, -1)
+
+	m := NewMatcher([]config.JunkPattern{
+		{Name: "node_modules", Pattern: "**/node_modules", Safe: true, RegenCost: 4},
+		{Name: "Python cache", Pattern: "**/__pycache__", Safe: true},
+		{Name: "Git repos", Pattern: "**/.git", Safe: false},
+	})
+	c := NewJunkCollector("/root", m)
+
+	add := func(dir string, size int64, mod time.Time) {
+		c.Add(Entry{Path: dir, Name: filepath.Base(dir), IsDir: true, ModTime: old})
+		c.Add(Entry{Path: dir + "/f", Name: "f", Size: size, ModTime: mod})
+	}
+	add("/root/active/node_modules", 5000, recent)
+	add("/root/stale/node_modules", 1000, old)
+	add("/root/stale/__pycache__", 2000, old)
+	add("/root/repo/.git", 9000, old)
+
+	got := c.Candidates(BudgetOptions{StaleAfter: 30 * 24 * time.Hour, Now: now})
+	want := []string{"/root/stale/__pycache__", "/root/stale/node_modules", "/root/active/node_modules"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d candidates, got %+v", len(want), got)
+	}
+	for i, path := range want {
+		if got[i].Path != path {
+			t.Errorf("candidate %d: expected %s, got %s", i, path, got[i].Path)
+		}
+	}
+	if got[2].Stale || !got[2].Modified.Equal(recent) {
+		t.Errorf("expected active node_modules modified %v, got %+v", recent, got[2])
+	}
+
+	// Weighing by cost moves cheap junk ahead among active candidates only
+	add("/root/active/__pycache__", 3000, recent)
+	got = c.Candidates(BudgetOptions{StaleAfter: 30 * 24 * time.Hour, WeighCost: true, Now: now})
+	if got[2].Path != "/root/active/__pycache__" {
+		t.Errorf("expected cheaper active cache ranked first among active, got %+v", got)
+	}
+}
+
+func TestJunkCollector_CandidatesNeedProjectMarker(t *testing.T) {
+	home := t.TempDir()
+	for _, dir := range []string{"go/bin", ".local/bin", "app/dist", "app/bin"} {
+		os.MkdirAll(filepath.Join(home, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(home, "app", "App.csproj"), nil, 0644)
+
+	m := NewMatcher([]config.JunkPattern{{Name: "build output", Pattern: "**/{bin,dist}", Safe: true}})
+	c := NewJunkCollector(home, m)
+	for _, dir := range []string{"go/bin", ".local/bin", "app/dist", "app/bin"} {
+		path := filepath.Join(home, dir)
+		c.Add(Entry{Path: path, Name: filepath.Base(path), IsDir: true})
+		c.Add(Entry{Path: filepath.Join(path, "tool"), Name: "tool", Size: 100})
+	}
+
+	var got []string
+	for _, cand := range c.Candidates(BudgetOptions{}) {
+		got = append(got, cand.Path)
+	}
+	want := []string{filepath.Join(home, "app", "bin"), filepath.Join(home, "app", "dist")}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected only the project's output %v, got %v", want, got)
+	}
+}
+
+func TestSelectBudget(t *testing.T) {
+	cands := []Candidate{
+		{Path: "/a", Size: 300},
+		{Path: "/b", Size: 100},
+		{Path: "/c", Size: 0},
+		{Path: "/d", Size: 800},
+	}
+
+	tests := []struct {
+		need      int64
+		wantPaths []string
+		wantTotal int64
+	}{
+		{need: 250, wantPaths: []string{"/a"}, wantTotal: 300},
+		{need: 400, wantPaths: []string{"/a", "/b"}, wantTotal: 400},
+		// /d alone covers the target, so the earlier picks are dropped
+		{need: 700, wantPaths: []string{"/d"}, wantTotal: 800},
+		{need: 5000, wantPaths: []string{"/a", "/b", "/d"}, wantTotal: 1200},
+	}
+	for _, tt := range tests {
+		got, total := SelectBudget(cands, tt.need)
+		if total != tt.wantTotal {
+			t.Errorf("need %d: expected total %d, got %d", tt.need, tt.wantTotal, total)
+		}
+		if len(got) != len(tt.wantPaths) {
+			t.Errorf("need %d: expected %v, got %+v", tt.need, tt.wantPaths, got)
+			continue
+		}
+		for i, p := range tt.wantPaths {
+			if got[i].Path != p {
+				t.Errorf("need %d: expected %v, got %+v", tt.need, tt.wantPaths, got)
+				break
+			}
+		}
+	}
+}
@@ -1,34 +1,167 @@
 package scanner
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/gitguard"
 	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/openfiles"
+	"github.com/0xjjjjjj/breathe/internal/trash"
 )
 
-// Paths that should never be deleted
-var protectedPaths = []string{
-	"/", "/usr", "/etc", "/var", "/tmp", "/opt",
-	"/bin", "/sbin", "/lib", "/lib64",
-	"/System", "/Library", "/Applications", // macOS
-	"/Windows", "/Program Files",            // Windows
-	"/home", "/root",                        // Linux
+var ErrProtectedPath = errors.New("refusing to delete protected path")
+var ErrPathTraversal = errors.New("path contains directory traversal")
+var ErrInUse = errors.New("refusing to delete path in use")
+
+// InUseError lists the processes holding files under a path being deleted.
+type InUseError struct {
+	Path    string
+	Holders []openfiles.Holder
 }
 
-var ErrProtectedPath = errors.New("refusing to delete protected system path")
-var ErrPathTraversal = errors.New("path contains directory traversal")
+func (e *InUseError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrInUse, e.Path)
+	for i, h := range e.Holders {
+		if i >= 3 {
+			msg += fmt.Sprintf("; and %d more", len(e.Holders)-3)
+			break
+		}
+		msg += "; " + h.String()
+	}
+	return msg + " (use --force to delete anyway)"
+}
+
+func (e *InUseError) Unwrap() error {
+	return ErrInUse
+}
+
+var ErrUnsavedWork = errors.New("refusing to delete unsaved git work")
+
+// ErrHistoryRequired is returned before touching a path when history is
+// required but can't be written.
+var ErrHistoryRequired = errors.New("refusing to delete without recording history")
+
+// UnsavedWorkError lists git repositories under a path that have uncommitted
+// or unpushed work.
+type UnsavedWorkError struct {
+	Path    string
+	Reports []gitguard.Report
+}
+
+func (e *UnsavedWorkError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrUnsavedWork, e.Path)
+	for _, r := range e.Reports {
+		msg += "; " + r.String()
+	}
+	return msg + " (use --force to delete anyway)"
+}
+
+func (e *UnsavedWorkError) Unwrap() error {
+	return ErrUnsavedWork
+}
 
 type Cleaner struct {
-	db       *history.DB
-	useTrash bool
+	db          *history.DB
+	useTrash    bool
+	policy      *Policy
+	guard       *Guard
+	gitCheck    string
+	force       bool
+	mover       *fsutil.Mover
+	trash       trash.Trash
+	quarantine  *trash.Quarantine
+	shredPasses int
+	batchID     string
+	sizes       *Tree      // Known sizes; nil walks every directory
+	historyMu   sync.Mutex // Serializes history writes from DeleteAll workers
+	requireHist bool
+	metadata    func(path string) map[string]string
 }
 
 func NewCleaner(db *history.DB, useTrash bool) *Cleaner {
-	return &Cleaner{db: db, useTrash: useTrash}
+	mover := fsutil.NewMover()
+	return &Cleaner{
+		db:       db,
+		useTrash: useTrash,
+		policy:   &Policy{},
+		guard:    NewGuard(config.DefaultConfig().Safety),
+		mover:    mover,
+		trash:    trash.Default(mover),
+	}
+}
+
+// SetPolicy makes the cleaner send items to the trash whenever the deletion
+// policy requires it, even if permanent deletion was requested.
+func (c *Cleaner) SetPolicy(p *Policy) {
+	c.policy = p
+}
+
+// OnProgress sets a callback for cross-device moves into the trash.
+func (c *Cleaner) OnProgress(fn func(fsutil.Progress)) {
+	c.mover.OnProgress = fn
+}
+
+// SetGuard replaces the default protected paths with configured ones.
+func (c *Cleaner) SetGuard(g *Guard) {
+	c.guard = g
+}
+
+// SetGitCheck sets how unsaved work in git repositories is handled: "block",
+// "warn" or "off". The default is "block".
+func (c *Cleaner) SetGitCheck(mode string) {
+	c.gitCheck = mode
+}
+
+// SetQuarantine sends every item to q instead of the trash or permanent
+// deletion. The quarantine is reversible, so the deletion policy is satisfied.
+func (c *Cleaner) SetQuarantine(q *trash.Quarantine) {
+	c.quarantine = q
+}
+
+// SetShred makes every deletion overwrite file contents passes times before
+// removing them, recording the files' hashes in history. Zero turns it off.
+// Shredding is permanent, so it takes precedence over the trash and policy.
+func (c *Cleaner) SetShred(passes int) {
+	c.shredPasses = passes
+}
+
+// SetBatch records every operation under batchID, so they can be undone together.
+func (c *Cleaner) SetBatch(batchID string) {
+	c.batchID = batchID
+}
+
+// SetSizes makes Decide take directory sizes from t instead of walking them,
+// as long as the policy doesn't need to look inside for always_trash files.
+// t must be complete: a tree still being scanned has partial sizes.
+func (c *Cleaner) SetSizes(t *Tree) {
+	c.sizes = t
+}
+
+// SetMetadata makes Delete record the metadata fn returns for each path, such
+// as where the deletion came from, alongside its own.
+func (c *Cleaner) SetMetadata(fn func(path string) map[string]string) {
+	c.metadata = fn
+}
+
+// SetRequireHistory makes Delete refuse with ErrHistoryRequired when it can't
+// record its intent before removing anything.
+func (c *Cleaner) SetRequireHistory(require bool) {
+	c.requireHist = require
+}
+
+// SetForce skips the checks for processes using the path and unsaved git work.
+func (c *Cleaner) SetForce(force bool) {
+	c.force = force
 }
 
 // validatePath ensures the path is safe to delete
@@ -44,13 +177,6 @@ func validatePath(path string) error {
 		return ErrPathTraversal
 	}
 
-	// Check against protected paths
-	for _, protected := range protectedPaths {
-		if cleaned == protected {
-			return fmt.Errorf("%w: %s", ErrProtectedPath, path)
-		}
-	}
-
 	// Don't allow deleting home directory itself
 	home, _ := os.UserHomeDir()
 	if cleaned == home {
@@ -66,76 +192,271 @@ func validatePath(path string) error {
 	return nil
 }
 
-func (c *Cleaner) Delete(path string) error {
+// Decide validates path and works out whether Delete would trash it.
+func (c *Cleaner) Decide(path string) (Decision, error) {
 	// Validate path before any operations
 	if err := validatePath(path); err != nil {
-		return err
+		return Decision{Path: path}, err
+	}
+	if err := c.guard.Check(path); err != nil {
+		return Decision{Path: path}, err
+	}
+	if !c.force {
+		// Deleting files a process holds open frees no space and can break it
+		holders, err := openfiles.Under(path)
+		if err != nil {
+			return Decision{Path: path}, err
+		}
+		if len(holders) > 0 {
+			return Decision{Path: path}, &InUseError{Path: path, Holders: holders}
+		}
+	}
+
+	var warnings []string
+	if c.gitCheck != "off" {
+		reports, err := gitguard.Check(path)
+		if err != nil {
+			return Decision{Path: path}, err
+		}
+		if len(reports) > 0 && c.gitCheck != "warn" && !c.force {
+			return Decision{Path: path}, &UnsavedWorkError{Path: path, Reports: reports}
+		}
+		for _, r := range reports {
+			warnings = append(warnings, r.String())
+		}
 	}
 
 	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return Decision{Path: path}, err
 	}
 
 	var size int64
+	var protectedExt string
 	if info.IsDir() {
-		size = c.dirSize(path)
+		known, ok := c.knownSize(path)
+		if ok && (c.useTrash || c.quarantine != nil || len(c.policy.alwaysTrash) == 0) {
+			size = known
+		} else {
+			size, protectedExt = c.inspectDir(path)
+		}
 	} else {
 		size = info.Size()
+		protectedExt = c.policy.AlwaysTrashExt(path)
 	}
 
-	opType := history.OpDelete
-	var destPath string
+	d := c.policy.Decide(path, size, protectedExt, c.useTrash)
+	if c.quarantine != nil {
+		d.Trash = false
+		d.Quarantine = true
+		d.Reason = "quarantine requested"
+	}
+	if c.shredPasses > 0 {
+		d.Trash = false
+		d.Quarantine = false
+		d.Shred = true
+		d.Reason = fmt.Sprintf("shred requested, %d passes", c.shredPasses)
+	}
+	d.Warnings = warnings
+	return d, nil
+}
+
+// Delete removes path according to Decide and returns the decision taken.
+func (c *Cleaner) Delete(path string) (Decision, error) {
+	d, err := c.Decide(path)
+	if err != nil {
+		return d, err
+	}
 
-	if c.useTrash {
+	info, err := os.Stat(path)
+	if err != nil {
+		return d, err
+	}
+
+	opType := history.OpDelete
+	switch {
+	case d.Quarantine:
+		opType = history.OpQuarantine
+	case d.Trash:
 		opType = history.OpTrash
-		destPath, err = c.moveToTrash(path)
-		if err != nil {
-			return err
+	case d.Shred:
+		opType = history.OpShred
+	}
+	op := history.Operation{
+		Type:       opType,
+		SourcePath: path,
+		FileSize:   d.Size,
+		Metadata:   make(map[string]string),
+		BatchID:    c.batchID,
+	}
+	if c.metadata != nil {
+		for k, v := range c.metadata(path) {
+			op.Metadata[k] = v
 		}
-	} else {
-		if info.IsDir() {
-			err = os.RemoveAll(path)
-		} else {
-			err = os.Remove(path)
+	}
+
+	// Record the intent before the filesystem step, so an interrupted delete
+	// can be recovered. remove calls begin once it knows where the item goes.
+	var intent int64
+	begin := func() error {
+		var err error
+		if c.db != nil {
+			c.historyMu.Lock()
+			intent, err = c.db.Begin(op)
+			c.historyMu.Unlock()
 		}
-		if err != nil {
-			return err
+		if c.requireHist {
+			if c.db == nil {
+				return fmt.Errorf("%w: history is unavailable", ErrHistoryRequired)
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrHistoryRequired, err)
+			}
+		}
+		return nil
+	}
+
+	// A partial move left a complete copy in the trash or quarantine, so it
+	// is recorded like a finished one; the error is still returned.
+	err = c.remove(path, info, &d, &op, begin)
+	var partial *fsutil.PartialMoveError
+	if err != nil && !errors.As(err, &partial) {
+		if intent != 0 {
+			c.historyMu.Lock()
+			c.db.Fail(intent, err)
+			c.historyMu.Unlock()
 		}
+		return d, err
 	}
 
 	if c.db != nil {
-		c.db.Record(history.Operation{
-			Type:       opType,
-			SourcePath: path,
-			DestPath:   destPath,
-			FileSize:   size,
-			Reversible: c.useTrash,
+		c.historyMu.Lock()
+		defer c.historyMu.Unlock()
+		op.Reversible = d.Trash || d.Quarantine
+		var rerr error
+		if intent != 0 {
+			rerr = c.db.Complete(intent, op)
+		} else {
+			_, rerr = c.db.Record(op)
+		}
+		if rerr != nil {
+			return d, &history.NotRecordedError{Op: op, Err: rerr}
+		}
+	}
+
+	return d, err
+}
+
+// remove carries out the filesystem step of d, filling in what op records
+// about it, and calls begin right before anything changes. Items moved to the
+// trash or quarantine get their place first, so op.DestPath is set by then.
+// op.Metadata must not be nil.
+func (c *Cleaner) remove(path string, info os.FileInfo, d *Decision, op *history.Operation, begin func() error) error {
+	switch {
+	case d.Quarantine:
+		_, err := c.quarantine.PutWith(path, func(item *trash.Item) error {
+			op.DestPath = item.Path
+			op.Metadata["expires_at"] = item.ExpiresAt.UTC().Format(time.RFC3339)
+			return begin()
 		})
+		return err
+	case d.Trash:
+		_, err := c.trash.PutWith(path, func(item *trash.Item) error {
+			op.DestPath = item.Path
+			return begin()
+		})
+		return err
 	}
 
+	if err := begin(); err != nil {
+		return err
+	}
+	switch {
+	case d.Shred:
+		files, err := fsutil.Inventory(path)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.Skipped != "" {
+				d.Warnings = append(d.Warnings, fmt.Sprintf("not overwritten: %s is %s", f.Path, f.Skipped))
+			}
+		}
+		if err := fsutil.Shred(path, files, c.shredPasses); err != nil {
+			return err
+		}
+		op.FileHash = fsutil.ManifestHash(path, files)
+		if !info.IsDir() && len(files) == 1 {
+			op.FileHash = files[0].SHA256
+		}
+		manifest, _ := json.Marshal(files)
+		op.Metadata["passes"] = strconv.Itoa(c.shredPasses)
+		op.Metadata["manifest"] = string(manifest)
+	case info.IsDir():
+		return os.RemoveAll(path)
+	default:
+		return os.Remove(path)
+	}
 	return nil
 }
 
-func (c *Cleaner) moveToTrash(path string) (string, error) {
-	home, _ := os.UserHomeDir()
-	trashPath := filepath.Join(home, ".Trash", filepath.Base(path))
+func (c *Cleaner) knownSize(path string) (int64, bool) {
+	if c.sizes == nil {
+		return 0, false
+	}
+	return c.sizes.Size(path)
+}
 
-	// Handle duplicates in trash
-	if _, err := os.Stat(trashPath); err == nil {
-		trashPath = filepath.Join(home, ".Trash", fmt.Sprintf("%s_%d", filepath.Base(path), os.Getpid()))
+// DeleteWorkers is the pool size callers of DeleteAll use. Deleting is bound
+// by filesystem metadata updates, so a few workers are enough.
+const DeleteWorkers = 4
+
+// DeleteResult is the outcome of deleting one path with DeleteAll.
+type DeleteResult struct {
+	Index    int // Position of the path in the slice passed to DeleteAll
+	Decision Decision
+	Err      error
+}
+
+// DeleteAll deletes paths with up to workers concurrent deletions and sends
+// a result for each path as soon as it is done, closing results at the end.
+func (c *Cleaner) DeleteAll(paths []string, workers int, results chan<- DeleteResult) {
+	defer close(results)
+
+	if workers < 1 {
+		workers = 1
 	}
 
-	return trashPath, os.Rename(path, trashPath)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d, err := c.Delete(path)
+			results <- DeleteResult{Index: i, Decision: d, Err: err}
+		}(i, path)
+	}
+	wg.Wait()
 }
 
-func (c *Cleaner) dirSize(path string) int64 {
+// inspectDir returns the total size of a directory and the first always_trash
+// extension found inside it.
+func (c *Cleaner) inspectDir(path string) (int64, string) {
 	var size int64
-	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+	var protectedExt string
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
 		if err == nil && !info.IsDir() {
 			size += info.Size()
+			if protectedExt == "" {
+				protectedExt = c.policy.AlwaysTrashExt(p)
+			}
 		}
 		return nil
 	})
-	return size
+	return size, protectedExt
 }
@@ -0,0 +1,247 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+func TestCleaner_RefusesPathInUse(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("needs /proc")
+	}
+
+	tmpDir := t.TempDir()
+	busy := filepath.Join(tmpDir, "busy")
+	os.MkdirAll(busy, 0755)
+
+	cmd := exec.Command("sleep", "30")
+	cmd.Dir = busy
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	c := NewCleaner(nil, true)
+	c.trash = &trash.HomeTrash{Dir: filepath.Join(tmpDir, "Trash")}
+
+	_, err := c.Delete(busy)
+	var inUse *InUseError
+	if !errors.As(err, &inUse) {
+		t.Fatalf("expected InUseError, got %v", err)
+	}
+	if !errors.Is(err, ErrInUse) {
+		t.Error("InUseError should match ErrInUse")
+	}
+	if len(inUse.Holders) == 0 || inUse.Holders[0].PID != cmd.Process.Pid {
+		t.Errorf("expected sleep pid %d as holder, got %v", cmd.Process.Pid, inUse.Holders)
+	}
+	if _, err := os.Stat(busy); err != nil {
+		t.Error("busy directory should not be deleted")
+	}
+
+	c.SetForce(true)
+	if _, err := c.Delete(busy); err != nil {
+		t.Fatalf("Delete() with force error = %v", err)
+	}
+}
+
+func TestCleaner_GitCheck(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "repo")
+	os.MkdirAll(repo, 0755)
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	os.WriteFile(filepath.Join(repo, "draft.txt"), []byte("unsaved"), 0644)
+
+	c := NewCleaner(nil, true)
+	c.trash = &trash.HomeTrash{Dir: filepath.Join(tmpDir, "Trash")}
+
+	_, err := c.Delete(repo)
+	if !errors.Is(err, ErrUnsavedWork) {
+		t.Fatalf("expected ErrUnsavedWork, got %v", err)
+	}
+
+	c.SetGitCheck("warn")
+	d, err := c.Delete(repo)
+	if err != nil {
+		t.Fatalf("Delete() in warn mode error = %v", err)
+	}
+	if len(d.Warnings) != 1 {
+		t.Errorf("expected 1 warning, got %v", d.Warnings)
+	}
+}
+
+func TestCleaner_Quarantine(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := history.Open(filepath.Join(tmpDir, "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	target := filepath.Join(tmpDir, "work", "export")
+	os.MkdirAll(target, 0755)
+	os.WriteFile(filepath.Join(target, "data.csv"), []byte("a,b"), 0644)
+
+	c := NewCleaner(db, true)
+	c.SetGitCheck("off")
+	c.SetQuarantine(trash.NewQuarantine(filepath.Join(tmpDir, "quarantine"), 7*24*time.Hour, nil))
+
+	d, err := c.Delete(target)
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if !d.Quarantine || d.Trash {
+		t.Errorf("expected quarantine decision, got %+v", d)
+	}
+
+	ops, err := db.Reversible(history.OpQuarantine)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("expected 1 quarantine op, got %v (%v)", ops, err)
+	}
+	op := ops[0]
+	expires, err := time.Parse(time.RFC3339, op.Metadata["expires_at"])
+	if err != nil {
+		t.Fatalf("bad expires_at %q: %v", op.Metadata["expires_at"], err)
+	}
+	if until := time.Until(expires); until < 6*24*time.Hour || until > 8*24*time.Hour {
+		t.Errorf("expected expiry in about a week, got %v", expires)
+	}
+	if _, err := os.Stat(filepath.Join(op.DestPath, "data.csv")); err != nil {
+		t.Errorf("quarantined content missing: %v", err)
+	}
+
+	if err := trash.Unquarantine(nil, op.DestPath, op.SourcePath); err != nil {
+		t.Fatalf("Unquarantine() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "data.csv")); err != nil {
+		t.Errorf("restored content missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(op.DestPath)); !os.IsNotExist(err) {
+		t.Error("quarantine slot should be removed after restore")
+	}
+}
+
+func TestCleaner_DeleteAll(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "work")
+
+	var paths []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		dir := filepath.Join(root, name, "node_modules")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.js"), []byte("x"), 0644)
+		paths = append(paths, dir)
+	}
+	paths = append(paths, filepath.Join(root, "missing"))
+
+	// Sizes come from the tree rather than a walk
+	tree := NewTree(root)
+	for _, p := range paths[:5] {
+		tree.Add(p, true, 1000)
+	}
+
+	c := NewCleaner(nil, true)
+	c.trash = &trash.HomeTrash{Dir: filepath.Join(tmpDir, "Trash")}
+	c.SetGitCheck("off")
+	c.SetSizes(tree)
+
+	results := make(chan DeleteResult)
+	go c.DeleteAll(paths, 3, results)
+
+	seen := make(map[int]bool)
+	for r := range results {
+		seen[r.Index] = true
+		if r.Index == 5 {
+			if r.Err == nil {
+				t.Error("expected an error for the missing path")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("Delete(%s) error = %v", paths[r.Index], r.Err)
+		}
+		if r.Decision.Size != 1000 {
+			t.Errorf("expected size 1000 from the tree, got %d", r.Decision.Size)
+		}
+	}
+	if len(seen) != len(paths) {
+		t.Errorf("expected %d results, got %d", len(paths), len(seen))
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(tmpDir, "Trash"))
+	if len(entries) != 5 {
+		t.Errorf("expected 5 distinct trash entries, got %d", len(entries))
+	}
+}
+
+func TestCleaner_History(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "old.log")
+	os.WriteFile(file, []byte("log"), 0644)
+
+	// Required history that isn't there stops the delete before it happens
+	c := NewCleaner(nil, false)
+	c.SetRequireHistory(true)
+	if _, err := c.Delete(file); !errors.Is(err, ErrHistoryRequired) {
+		t.Fatalf("expected ErrHistoryRequired, got %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal("file should not be deleted without history")
+	}
+
+	// The intent is recorded before the delete and completed after it
+	db, err := history.Open(filepath.Join(tmpDir, "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	other := filepath.Join(tmpDir, "other.log")
+	os.WriteFile(other, []byte("log"), 0644)
+	c = NewCleaner(db, false)
+	c.SetRequireHistory(true)
+	c.SetMetadata(func(path string) map[string]string {
+		return map[string]string{"origin": "test", "name": filepath.Base(path)}
+	})
+	if _, err := c.Delete(other); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	ops, _ := db.Query(history.Filter{Text: "other.log"})
+	if len(ops) != 1 || ops[0].State != history.StateApplied {
+		t.Fatalf("expected one applied delete, got %+v", ops)
+	}
+	if md := ops[0].Metadata; md["origin"] != "test" || md["name"] != "other.log" {
+		t.Errorf("expected the caller's metadata recorded, got %v", md)
+	}
+
+	// Required history that can't be written stops the delete too
+	db.Close()
+	if _, err := c.Delete(file); !errors.Is(err, ErrHistoryRequired) {
+		t.Fatalf("expected ErrHistoryRequired, got %v", err)
+	}
+
+	// Otherwise a failed record is reported even though the delete went ahead
+	c = NewCleaner(db, false)
+	_, err = c.Delete(file)
+	var notRecorded *history.NotRecordedError
+	if !errors.As(err, &notRecorded) || !errors.Is(err, history.ErrNotRecorded) {
+		t.Fatalf("expected NotRecordedError, got %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("file should be deleted")
+	}
+}
@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+var ErrOutsideAllowedRoots = errors.New("refusing to delete outside allowed roots")
+
+// Guard enforces the configured protected paths and allowed roots.
+type Guard struct {
+	protected []guardRule
+	allowed   []string
+}
+
+type guardRule struct {
+	rule    string // As written in the config, for error messages
+	pattern string // Expanded glob
+	base    string // Literal directory prefix of pattern
+}
+
+func NewGuard(s config.Safety) *Guard {
+	g := &Guard{}
+	for _, p := range s.ProtectedPaths {
+		pattern := filepath.Clean(config.ExpandHome(p))
+		base := pattern
+		if strings.ContainsAny(pattern, "*?[{\\") {
+			base, _ = doublestar.SplitPattern(pattern)
+		}
+		g.protected = append(g.protected, guardRule{rule: p, pattern: pattern, base: base})
+	}
+	for _, root := range s.AllowedRoots {
+		root = filepath.Clean(config.ExpandHome(root))
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+		g.allowed = append(g.allowed, root)
+	}
+	return g
+}
+
+// Check returns an error naming the rule that forbids deleting path: either
+// path matches a protected rule, contains something protected, or lies
+// outside every allowed root. Path is checked both as written and with the
+// symlinks in its parent resolved, since that is what a delete removes.
+func (g *Guard) Check(path string) error {
+	path = filepath.Clean(path)
+	real := resolveParent(path)
+
+	for _, p := range []string{path, real} {
+		for _, r := range g.protected {
+			if matched, _ := doublestar.PathMatch(r.pattern, p); matched {
+				return fmt.Errorf("%w: %s matches protected rule %q", ErrProtectedPath, path, r.rule)
+			}
+			if isWithin(r.base, p) && r.base != p {
+				return fmt.Errorf("%w: %s contains %s (protected rule %q)", ErrProtectedPath, path, r.base, r.rule)
+			}
+		}
+	}
+
+	if len(g.allowed) == 0 {
+		return nil
+	}
+	for _, root := range g.allowed {
+		if isWithin(real, root) && real != root {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not under any of %s", ErrOutsideAllowedRoots, path, strings.Join(g.allowed, ", "))
+}
+
+// resolveParent resolves the symlinks in path's parent directory, keeping the
+// final component so a symlink itself is not followed. It returns path as is
+// if the parent cannot be resolved.
+func resolveParent(path string) string {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return path
+	}
+	return filepath.Join(dir, filepath.Base(path))
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if dir == string(filepath.Separator) {
+		return strings.HasPrefix(path, dir)
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
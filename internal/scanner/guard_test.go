@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+func TestGuard_DefaultRules(t *testing.T) {
+	g := NewGuard(config.DefaultConfig().Safety)
+	home, _ := os.UserHomeDir()
+
+	blocked := []string{
+		"/usr/lib",
+		"/etc/ssh/sshd_config",
+		filepath.Join(home, ".ssh"),
+		filepath.Join(home, ".ssh", "id_ed25519"),
+		filepath.Join(home, ".gnupg", "private-keys-v1.d"),
+		filepath.Dir(home), // Contains the home directory
+	}
+	for _, path := range blocked {
+		if err := g.Check(path); !errors.Is(err, ErrProtectedPath) {
+			t.Errorf("Check(%s) = %v, want ErrProtectedPath", path, err)
+		}
+	}
+
+	allowed := []string{
+		filepath.Join(home, "projects", "app", "node_modules"),
+		"/tmp/build-cache",
+	}
+	for _, path := range allowed {
+		if err := g.Check(path); err != nil {
+			t.Errorf("Check(%s) = %v, want nil", path, err)
+		}
+	}
+}
+
+func TestGuard_ErrorNamesRule(t *testing.T) {
+	g := NewGuard(config.Safety{ProtectedPaths: []string{"/data/keep/**"}})
+
+	err := g.Check("/data/keep/important.db")
+	if err == nil || !strings.Contains(err.Error(), `"/data/keep/**"`) {
+		t.Errorf("expected error naming the rule, got %v", err)
+	}
+
+	err = g.Check("/data")
+	if err == nil || !strings.Contains(err.Error(), "contains /data/keep") {
+		t.Errorf("expected error for ancestor of protected path, got %v", err)
+	}
+}
+
+func TestGuard_AllowedRoots(t *testing.T) {
+	g := NewGuard(config.Safety{AllowedRoots: []string{"/srv/builds", "/tmp"}})
+
+	if err := g.Check("/srv/builds/job-1"); err != nil {
+		t.Errorf("expected path under allowed root to pass, got %v", err)
+	}
+	if err := g.Check("/srv/builds"); !errors.Is(err, ErrOutsideAllowedRoots) {
+		t.Errorf("expected the root itself to be refused, got %v", err)
+	}
+	if err := g.Check("/srv/builds-old/job-1"); !errors.Is(err, ErrOutsideAllowedRoots) {
+		t.Errorf("expected sibling with shared prefix to be refused, got %v", err)
+	}
+	if err := g.Check("/var/lib/app"); !errors.Is(err, ErrOutsideAllowedRoots) {
+		t.Errorf("expected path outside roots to be refused, got %v", err)
+	}
+}
+
+func TestGuard_ResolvesSymlinks(t *testing.T) {
+	home, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	os.MkdirAll(filepath.Join(home, "projects"), 0755)
+	os.MkdirAll(filepath.Join(home, "secrets"), 0700)
+	if err := os.Symlink(home, filepath.Join(home, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	os.Symlink(filepath.Join(home, "secrets"), filepath.Join(home, "projects", "escape"))
+
+	g := NewGuard(config.Safety{
+		ProtectedPaths: []string{home, filepath.Join(home, ".ssh/**")},
+		AllowedRoots:   []string{filepath.Join(home, "projects")},
+	})
+	if err := g.Check(filepath.Join(home, "link", ".ssh")); !errors.Is(err, ErrProtectedPath) {
+		t.Errorf("expected protected dir reached through a symlink to be refused, got %v", err)
+	}
+	if err := g.Check(filepath.Join(home, "projects", "escape", "keys")); !errors.Is(err, ErrOutsideAllowedRoots) {
+		t.Errorf("expected path leaving the allowed root through a symlink to be refused, got %v", err)
+	}
+	// The symlink itself is removed, not its target
+	if err := g.Check(filepath.Join(home, "projects", "escape")); err != nil {
+		t.Errorf("expected the symlink itself to pass, got %v", err)
+	}
+}
@@ -13,6 +13,15 @@ type JSONOutput struct {
 	Junk       []JunkGroup `json:"junk,omitempty"`
 }
 
+// JunkJSONOutput is the --junk variant of JSONOutput: totals plus junk groups,
+// without the children tree.
+type JunkJSONOutput struct {
+	Path       string      `json:"path"`
+	TotalSize  int64       `json:"total_size"`
+	TotalFiles int         `json:"total_files"`
+	Junk       []JunkGroup `json:"junk"`
+}
+
 type JSONEntry struct {
 	Path     string      `json:"path"`
 	Name     string      `json:"name"`
@@ -68,3 +77,17 @@ func (t *Tree) childrenToJSON(path string, depth, maxDepth int) []JSONEntry {
 
 	return entries
 }
+
+func (c *JunkCollector) ToJSON(w io.Writer) error {
+	root := c.tree.Root()
+	output := JunkJSONOutput{
+		Path:       root.Path,
+		TotalSize:  root.Size,
+		TotalFiles: c.FileCount(),
+		Junk:       c.Groups(),
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(output)
+}
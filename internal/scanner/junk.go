@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// JunkCollector builds a sparse tree from scan results that only contains
+// junk roots and their ancestors. Everything outside junk is counted towards
+// the root total but never gets its own node, which keeps memory flat on
+// large trees when only junk is of interest.
+//
+// Entries must be added in scan order (a directory before its contents),
+// which is what Scan guarantees. A JunkCollector is not safe for concurrent use.
+type JunkCollector struct {
+	matcher  *Matcher
+	tree     *Tree
+	roots    map[string]bool
+	modified map[string]time.Time // Newest modification inside each junk root
+	files    int
+}
+
+func NewJunkCollector(rootPath string, matcher *Matcher) *JunkCollector {
+	c := &JunkCollector{
+		matcher:  matcher,
+		tree:     NewTree(rootPath),
+		roots:    make(map[string]bool),
+		modified: make(map[string]time.Time),
+	}
+	// Scanning inside a junk directory makes everything junk
+	if len(matcher.Match(rootPath)) > 0 {
+		c.roots[rootPath] = true
+	}
+	return c
+}
+
+func (c *JunkCollector) Add(e Entry) {
+	if !e.IsDir {
+		c.files++
+	}
+
+	if root := c.junkAncestor(e.Path); root != "" {
+		if !e.IsDir {
+			c.tree.addSize(root, e.Size)
+		}
+		c.touch(root, e.ModTime)
+		return
+	}
+
+	if len(c.matcher.Match(e.Path)) > 0 {
+		c.roots[e.Path] = true
+		c.tree.AddEntry(e)
+		c.touch(e.Path, e.ModTime)
+		return
+	}
+
+	if !e.IsDir {
+		c.tree.addSize(c.tree.root.Path, e.Size)
+	}
+}
+
+func (c *JunkCollector) touch(root string, t time.Time) {
+	if t.After(c.modified[root]) {
+		c.modified[root] = t
+	}
+}
+
+// Modified returns the newest modification time of the junk root at path or
+// anything inside it, or the zero time if path is not a junk root.
+func (c *JunkCollector) Modified(path string) time.Time {
+	return c.modified[path]
+}
+
+// junkAncestor returns the junk root that contains path, or "" if none does.
+func (c *JunkCollector) junkAncestor(path string) string {
+	rootPath := c.tree.root.Path
+	for dir := filepath.Dir(path); dir != path && len(dir) >= len(rootPath); path, dir = dir, filepath.Dir(dir) {
+		if c.roots[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+func (c *JunkCollector) Tree() *Tree {
+	return c.tree
+}
+
+// FileCount returns the number of files seen, including those outside junk.
+func (c *JunkCollector) FileCount() int {
+	return c.files
+}
+
+// Groups returns the junk groups found so far, largest first.
+func (c *JunkCollector) Groups() []JunkGroup {
+	groups := c.matcher.GroupJunk(c.tree)
+	SortJunkGroups(c.tree, groups)
+	return groups
+}
+
+// SortJunkGroups orders groups by total size and each group's paths by size,
+// largest first.
+func SortJunkGroups(tree *Tree, groups []JunkGroup) {
+	for _, g := range groups {
+		sort.Slice(g.Paths, func(i, j int) bool {
+			return nodeSize(tree, g.Paths[i]) > nodeSize(tree, g.Paths[j])
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Total > groups[j].Total
+	})
+}
+
+func nodeSize(tree *Tree, path string) int64 {
+	if node := tree.Get(path); node != nil {
+		return node.Size
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+func TestJunkCollector_SizesJunkOnly(t *testing.T) {
+	m := NewMatcher([]config.JunkPattern{
+		{Name: "node_modules", Pattern: "**/node_modules", Safe: true},
+	})
+	c := NewJunkCollector("/root", m)
+
+	c.Add(Entry{Path: "/root/src", Name: "src", IsDir: true})
+	c.Add(Entry{Path: "/root/src/main.go", Name: "main.go", Size: 100})
+	c.Add(Entry{Path: "/root/app", Name: "app", IsDir: true})
+	c.Add(Entry{Path: "/root/app/node_modules", Name: "node_modules", IsDir: true})
+	c.Add(Entry{Path: "/root/app/node_modules/lodash", Name: "lodash", IsDir: true})
+	c.Add(Entry{Path: "/root/app/node_modules/lodash/index.js", Name: "index.js", Size: 500})
+	c.Add(Entry{Path: "/root/app/node_modules/a.js", Name: "a.js", Size: 250})
+
+	tree := c.Tree()
+	if tree.Root().Size != 850 {
+		t.Errorf("expected root size 850, got %d", tree.Root().Size)
+	}
+	if c.FileCount() != 3 {
+		t.Errorf("expected 3 files, got %d", c.FileCount())
+	}
+
+	// Non-junk subtrees should not be materialized
+	if tree.Get("/root/src") != nil || tree.Get("/root/src/main.go") != nil {
+		t.Error("non-junk entries should not be in the tree")
+	}
+	if tree.Get("/root/app/node_modules/lodash") != nil {
+		t.Error("entries inside junk should not be in the tree")
+	}
+
+	groups := c.Groups()
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if groups[0].Total != 750 {
+		t.Errorf("expected junk total 750, got %d", groups[0].Total)
+	}
+}
+
+func TestSortJunkGroups_LargestFirst(t *testing.T) {
+	tree := NewTree("/")
+	tree.Add("/a/small", true, 10)
+	tree.Add("/b/large", true, 1000)
+
+	groups := []JunkGroup{
+		{Name: "small", Paths: []string{"/a/small"}, Total: 10},
+		{Name: "mixed", Paths: []string{"/a/small", "/b/large"}, Total: 1010},
+	}
+	SortJunkGroups(tree, groups)
+
+	if groups[0].Name != "mixed" {
+		t.Errorf("expected largest group first, got %s", groups[0].Name)
+	}
+	if groups[0].Paths[0] != "/b/large" {
+		t.Errorf("expected largest path first, got %s", groups[0].Paths[0])
+	}
+}
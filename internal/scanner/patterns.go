@@ -1,6 +1,9 @@
 package scanner
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/0xjjjjjj/breathe/internal/config"
 )
@@ -39,6 +42,72 @@ func (m *Matcher) Match(path string) []Match {
 	return matches
 }
 
+// RegenCost returns the regeneration cost of the named pattern, 1 if unset.
+func (m *Matcher) RegenCost(name string) float64 {
+	for _, p := range m.patterns {
+		if p.Name == name && p.RegenCost > 0 {
+			return p.RegenCost
+		}
+	}
+	return 1
+}
+
+// Explanation describes why a single junk pattern did or did not match a path.
+type Explanation struct {
+	Pattern config.JunkPattern
+	Matched bool
+	Err     error
+	Reason  string
+}
+
+// Explain reports the outcome of every pattern for path, including patterns
+// that Match skips because they cannot be parsed.
+func (m *Matcher) Explain(path string) []Explanation {
+	explanations := make([]Explanation, 0, len(m.patterns))
+	for _, p := range m.patterns {
+		explanations = append(explanations, ExplainPattern(p, path))
+	}
+	return explanations
+}
+
+func ExplainPattern(p config.JunkPattern, path string) Explanation {
+	e := Explanation{Pattern: p}
+
+	matched, err := doublestar.PathMatch(p.Pattern, path)
+	switch {
+	case err != nil:
+		e.Err = err
+		e.Reason = fmt.Sprintf("invalid pattern: %v", err)
+	case matched:
+		e.Matched = true
+		e.Reason = "matches"
+	default:
+		if warnings := PatternWarnings(p); len(warnings) > 0 {
+			e.Reason = warnings[0]
+		} else {
+			e.Reason = "pattern does not match path"
+		}
+	}
+	return e
+}
+
+// PatternWarnings returns problems with a valid pattern that make it unlikely
+// to ever match a scanned path.
+func PatternWarnings(p config.JunkPattern) []string {
+	var warnings []string
+	if strings.HasSuffix(p.Pattern, "/") {
+		warnings = append(warnings, fmt.Sprintf(
+			"pattern ends with \"/\" but paths are matched without a trailing slash; try %q",
+			strings.TrimSuffix(p.Pattern, "/")))
+	}
+	if !strings.HasPrefix(p.Pattern, "/") && !strings.HasPrefix(p.Pattern, "**") {
+		warnings = append(warnings, fmt.Sprintf(
+			"pattern is relative but must match the whole absolute path; try %q",
+			"**/"+p.Pattern))
+	}
+	return warnings
+}
+
 func (m *Matcher) FindJunk(tree *Tree) map[string][]Match {
 	junk := make(map[string][]Match)
 
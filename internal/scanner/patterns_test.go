@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/0xjjjjjj/breathe/internal/config"
@@ -143,3 +144,63 @@ func TestMatcher_InvalidPattern(t *testing.T) {
 		t.Errorf("expected 0 matches for invalid pattern, got %d", len(matches))
 	}
 }
+
+func TestExplainPattern_ReportsInvalidPattern(t *testing.T) {
+	e := ExplainPattern(config.JunkPattern{Name: "invalid", Pattern: "[invalid"}, "/some/path")
+	if e.Matched {
+		t.Error("invalid pattern should not match")
+	}
+	if e.Err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestExplainPattern_TrailingSlashHint(t *testing.T) {
+	e := ExplainPattern(config.JunkPattern{Name: "dist", Pattern: "**/dist/"}, "/project/dist")
+	if e.Matched {
+		t.Fatal("trailing slash pattern should not match")
+	}
+	if !strings.Contains(e.Reason, "trailing slash") {
+		t.Errorf("expected trailing slash hint, got %q", e.Reason)
+	}
+}
+
+func TestMatcher_Explain(t *testing.T) {
+	m := NewMatcher([]config.JunkPattern{
+		{Name: "node_modules", Pattern: "**/node_modules"},
+		{Name: "relative", Pattern: "node_modules"},
+	})
+
+	explanations := m.Explain("/project/node_modules")
+	if len(explanations) != 2 {
+		t.Fatalf("expected 2 explanations, got %d", len(explanations))
+	}
+	if !explanations[0].Matched {
+		t.Error("expected first pattern to match")
+	}
+	if explanations[1].Matched || !strings.Contains(explanations[1].Reason, "relative") {
+		t.Errorf("expected relative pattern hint, got %q", explanations[1].Reason)
+	}
+}
+
+func TestDefaultPatterns_HaveNoWarnings(t *testing.T) {
+	for _, p := range config.DefaultConfig().JunkPatterns {
+		// Build output names are too common to match outside a project,
+		// so these defaults are left unable to match
+		if p.Name == "JS build output" || p.Name == "C# build output" {
+			continue
+		}
+		if warnings := PatternWarnings(p); len(warnings) > 0 {
+			t.Errorf("default pattern %q: %v", p.Name, warnings)
+		}
+	}
+}
+
+func TestDefaultPatterns_SkipHomeBinDirs(t *testing.T) {
+	m := NewMatcher(config.DefaultConfig().JunkPatterns)
+	for _, path := range []string{"/home/u/go/bin", "/home/u/.local/bin", "/home/u/build", "/home/u/out"} {
+		if matches := m.Match(path); len(matches) > 0 {
+			t.Errorf("%s matched %q", path, matches[0].Name)
+		}
+	}
+}
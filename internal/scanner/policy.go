@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/0xjjjjjj/breathe/internal/config"
+)
+
+// Policy decides whether an item goes to the trash or is deleted permanently,
+// based on the deletion section of the config.
+type Policy struct {
+	threshold     int64  // Items larger than this always go to trash; 0 disables
+	thresholdText string // Threshold as written in the config, for reasons
+	alwaysTrash   []string
+}
+
+// Decision records how a path is removed and why.
+type Decision struct {
+	Path       string   `json:"path"`
+	Size       int64    `json:"size"`
+	Trash      bool     `json:"trash"`
+	Quarantine bool     `json:"quarantine,omitempty"`
+	Shred      bool     `json:"shred,omitempty"`
+	Reason     string   `json:"reason"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+func NewPolicy(d config.Deletion) (*Policy, error) {
+	p := &Policy{thresholdText: d.TrashThreshold}
+	if d.TrashThreshold != "" {
+		threshold, err := config.ParseSize(d.TrashThreshold)
+		if err != nil {
+			return nil, err
+		}
+		p.threshold = threshold
+	}
+	for _, ext := range d.AlwaysTrash {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p.alwaysTrash = append(p.alwaysTrash, ext)
+	}
+	return p, nil
+}
+
+// AlwaysTrashExt returns the always_trash extension that name matches, or "".
+func (p *Policy) AlwaysTrashExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range p.alwaysTrash {
+		if ext == e {
+			return e
+		}
+	}
+	return ""
+}
+
+// Decide applies the policy to an item. protectedExt is an always_trash
+// extension found in the item (itself, or any file inside a directory).
+func (p *Policy) Decide(path string, size int64, protectedExt string, useTrash bool) Decision {
+	d := Decision{Path: path, Size: size, Trash: true}
+
+	switch {
+	case useTrash:
+		d.Reason = "trash requested"
+	case p.threshold > 0 && size > p.threshold:
+		d.Reason = fmt.Sprintf("larger than trash threshold %s", p.thresholdText)
+	case protectedExt != "":
+		d.Reason = fmt.Sprintf("always_trash: contains %s files", protectedExt)
+	default:
+		d.Trash = false
+		d.Reason = "permanent delete requested"
+	}
+	return d
+}
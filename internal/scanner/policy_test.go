@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+func TestPolicy_Decide(t *testing.T) {
+	p, err := NewPolicy(config.Deletion{TrashThreshold: "1KB", AlwaysTrash: []string{".pdf", "XLSX"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		size      int64
+		ext       string
+		useTrash  bool
+		wantTrash bool
+	}{
+		{"trash requested", 10, "", true, true},
+		{"small permanent", 10, "", false, false},
+		{"above threshold", 2048, "", false, true},
+		{"at threshold", 1024, "", false, false},
+		{"always trash", 10, ".pdf", false, true},
+	}
+	for _, tt := range tests {
+		d := p.Decide("/x", tt.size, tt.ext, tt.useTrash)
+		if d.Trash != tt.wantTrash {
+			t.Errorf("%s: Trash = %v, want %v (%s)", tt.name, d.Trash, tt.wantTrash, d.Reason)
+		}
+		if d.Reason == "" {
+			t.Errorf("%s: expected a reason", tt.name)
+		}
+	}
+
+	if ext := p.AlwaysTrashExt("/docs/Report.XLSX"); ext != ".xlsx" {
+		t.Errorf("expected .xlsx match, got %q", ext)
+	}
+}
+
+func TestNewPolicy_InvalidThreshold(t *testing.T) {
+	if _, err := NewPolicy(config.Deletion{TrashThreshold: "huge"}); err == nil {
+		t.Error("expected error for invalid threshold")
+	}
+}
+
+func TestCleaner_PolicyOverridesPermanentDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	work := filepath.Join(tmpDir, "work")
+	os.MkdirAll(filepath.Join(work, "docs"), 0755)
+	os.WriteFile(filepath.Join(work, "docs", "invoice.pdf"), []byte("pdf"), 0644)
+	os.WriteFile(filepath.Join(work, "scratch.txt"), []byte("tmp"), 0644)
+
+	p, _ := NewPolicy(config.Deletion{AlwaysTrash: []string{".pdf"}})
+	c := NewCleaner(nil, false)
+	c.SetPolicy(p)
+	c.trash = &trash.HomeTrash{Dir: filepath.Join(tmpDir, "Trash")}
+
+	d, err := c.Delete(filepath.Join(work, "docs"))
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if !d.Trash {
+		t.Error("directory containing a pdf should be trashed")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "Trash", "docs", "invoice.pdf")); err != nil {
+		t.Error("expected docs in trash")
+	}
+
+	d, err = c.Delete(filepath.Join(work, "scratch.txt"))
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if d.Trash {
+		t.Error("plain file should be deleted permanently")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "Trash", "scratch.txt")); !os.IsNotExist(err) {
+		t.Error("scratch.txt should not be in trash")
+	}
+}
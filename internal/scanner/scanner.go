@@ -4,13 +4,15 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 type Entry struct {
-	Path  string
-	Name  string
-	Size  int64
-	IsDir bool
+	Path    string
+	Name    string
+	Size    int64
+	IsDir   bool
+	ModTime time.Time
 }
 
 type ScanResult struct {
@@ -42,9 +44,10 @@ func Scan(root string, results chan<- ScanResult) {
 			}
 
 			entry := Entry{
-				Path:  fullPath,
-				Name:  e.Name(),
-				IsDir: e.IsDir(),
+				Path:    fullPath,
+				Name:    e.Name(),
+				IsDir:   e.IsDir(),
+				ModTime: info.ModTime(),
 			}
 
 			if !e.IsDir() {
@@ -102,6 +102,17 @@ func (t *Tree) propagateSize(path string, size int64) {
 	}
 }
 
+// addSize adds size to the node at path and all of its ancestors.
+func (t *Tree) addSize(path string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if node, ok := t.nodes[path]; ok {
+		node.Size += size
+	}
+	t.propagateSize(path, size)
+}
+
 func (t *Tree) Root() *Node {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -136,6 +147,18 @@ func (t *Tree) Get(path string) *Node {
 	return t.nodes[path]
 }
 
+// Size returns the size of the node at path, reading it under the tree's lock
+// so it is safe while the tree is being changed.
+func (t *Tree) Size(path string) (int64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, ok := t.nodes[path]
+	if !ok {
+		return 0, false
+	}
+	return node.Size, true
+}
+
 func (t *Tree) FileCount() int {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -0,0 +1,14 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+)
+
+// Default returns the trash for the current platform: ~/.Trash on macOS.
+func Default(mover *fsutil.Mover) Trash {
+	home, _ := os.UserHomeDir()
+	return &HomeTrash{Dir: filepath.Join(home, ".Trash"), Mover: mover}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package trash
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+)
+
+// Default returns the trash for the current platform. Platforms without a
+// supported trash get a plain ~/.Trash directory.
+func Default(mover *fsutil.Mover) Trash {
+	home, _ := os.UserHomeDir()
+	return &HomeTrash{Dir: filepath.Join(home, ".Trash"), Mover: mover}
+}
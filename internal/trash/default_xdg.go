@@ -0,0 +1,11 @@
+//go:build unix && !darwin
+
+package trash
+
+import "github.com/0xjjjjjj/breathe/internal/fsutil"
+
+// Default returns the trash for the current platform: the freedesktop.org
+// trash on Linux and other Unix desktops.
+func Default(mover *fsutil.Mover) Trash {
+	return NewXDG(mover)
+}
@@ -0,0 +1,78 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+)
+
+// Quarantine keeps deleted items in a breathe-managed directory for a limited
+// time. Items stay on their own filesystem where possible, so putting them
+// there is a rename and purging them frees space where it was used. Each item
+// gets its own slot directory, which keeps its name intact. The expiry is only
+// reported in the Item; callers record it.
+type Quarantine struct {
+	Dir   string        // Quarantine for the filesystem Dir is on
+	TTL   time.Duration // How long items are kept before they expire
+	UID   int
+	Mover *fsutil.Mover // nil uses fsutil.NewMover()
+}
+
+func NewQuarantine(dir string, ttl time.Duration, mover *fsutil.Mover) *Quarantine {
+	return &Quarantine{Dir: dir, TTL: ttl, UID: os.Getuid(), Mover: mover}
+}
+
+func (q *Quarantine) Put(path string) (*Item, error) {
+	return q.PutWith(path, nil)
+}
+
+// PutWith is Put, calling reserved with the Item once its slot exists and
+// before path is moved. An error from reserved cancels the Put.
+func (q *Quarantine) PutWith(path string, reserved func(*Item) error) (*Item, error) {
+	dir := q.dirFor(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	slot, err := os.MkdirTemp(dir, now.Format("20060102-150405-"))
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(slot, filepath.Base(path))
+	item := &Item{Path: dest, OriginalPath: path, DeletedAt: now, ExpiresAt: now.Add(q.TTL)}
+	if err := callReserved(reserved, item); err != nil {
+		os.Remove(slot)
+		return nil, err
+	}
+	if err := moverOrDefault(q.Mover).Move(path, dest); err != nil {
+		if isPartial(err) {
+			return item, err
+		}
+		os.Remove(slot)
+		return nil, err
+	}
+	return item, nil
+}
+
+// Unquarantine moves a quarantined path back to its original location with m
+// (nil uses a default Mover) and removes its slot.
+func Unquarantine(m *fsutil.Mover, quarantinedPath, originalPath string) error {
+	if err := moverOrDefault(m).Move(quarantinedPath, originalPath); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(quarantinedPath))
+	return nil
+}
+
+// PurgeQuarantined permanently removes a quarantined path and its slot.
+func PurgeQuarantined(quarantinedPath string) error {
+	if err := os.RemoveAll(quarantinedPath); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(quarantinedPath)) // Only succeeds if the slot is empty
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package trash
+
+// dirFor always returns q.Dir on platforms without device numbers.
+func (q *Quarantine) dirFor(path string) string {
+	return q.Dir
+}
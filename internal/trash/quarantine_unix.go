@@ -0,0 +1,31 @@
+//go:build unix
+
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// dirFor returns q.Dir when path is on the same device, otherwise a
+// .breathe-quarantine-$uid directory at the top of path's mount. It falls back
+// to q.Dir if that can't be created.
+func (q *Quarantine) dirFor(path string) string {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return q.Dir
+	}
+	if homeDev, err := deviceOf(existingParent(q.Dir)); err == nil && homeDev == dev {
+		return q.Dir
+	}
+
+	dir := filepath.Join(mountPoint(path, dev), ".breathe-quarantine-"+strconv.Itoa(q.UID))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return q.Dir
+	}
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		return q.Dir
+	}
+	return dir
+}
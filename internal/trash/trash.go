@@ -0,0 +1,144 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+)
+
+// Item is something that was moved into the trash.
+type Item struct {
+	Path         string    // Location inside the trash
+	OriginalPath string    // Where it was before being trashed
+	DeletedAt    time.Time // When it was trashed
+	InfoPath     string    // .trashinfo file, empty if the trash keeps none
+	ExpiresAt    time.Time // When a quarantined item may be purged; zero for the trash
+}
+
+// Trash moves files and directories out of the way so they can be restored.
+// If the item was copied in but its source could not be fully removed, Put
+// returns the Item along with a *fsutil.PartialMoveError.
+type Trash interface {
+	Put(path string) (*Item, error)
+	// PutWith is Put, calling reserved with the Item once its place in the
+	// trash is claimed and before path is moved, so callers can record where
+	// it will go. An error from reserved cancels the Put.
+	PutWith(path string, reserved func(*Item) error) (*Item, error)
+}
+
+// HomeTrash is a plain directory without metadata, like macOS's ~/.Trash.
+type HomeTrash struct {
+	Dir   string
+	Mover *fsutil.Mover // nil uses fsutil.NewMover()
+
+	mu sync.Mutex // Nothing reserves a name, so concurrent Puts could pick the same one
+}
+
+func (t *HomeTrash) Put(path string) (*Item, error) {
+	return t.PutWith(path, nil)
+}
+
+func (t *HomeTrash) PutWith(path string, reserved func(*Item) error) (*Item, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(t.Dir, filepath.Base(path))
+	for n := 2; exists(dest); n++ {
+		dest = filepath.Join(t.Dir, collisionName(filepath.Base(path), n))
+	}
+
+	item := &Item{Path: dest, OriginalPath: path, DeletedAt: time.Now()}
+	if err := callReserved(reserved, item); err != nil {
+		return nil, err
+	}
+	if err := moverOrDefault(t.Mover).Move(path, dest); err != nil {
+		if isPartial(err) {
+			return item, err
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// Restore moves a trashed path back to its original location with m (nil
+// uses a default Mover) and removes its .trashinfo file, if the trash keeps one.
+func Restore(m *fsutil.Mover, trashedPath, originalPath string) error {
+	if err := moverOrDefault(m).Move(trashedPath, originalPath); err != nil {
+		return err
+	}
+	if info := infoPathFor(trashedPath); info != "" {
+		os.Remove(info)
+	}
+	return nil
+}
+
+// Purge permanently removes a trashed path and its .trashinfo file.
+func Purge(trashedPath string) error {
+	info := infoPathFor(trashedPath)
+	if err := os.RemoveAll(trashedPath); err != nil {
+		return err
+	}
+	if info != "" {
+		os.Remove(info)
+	}
+	return nil
+}
+
+// infoPathFor returns the .trashinfo file that belongs to a path in the files
+// directory of an XDG trash, or "" if there is none.
+func infoPathFor(trashedPath string) string {
+	filesDir := filepath.Dir(trashedPath)
+	if filepath.Base(filesDir) != "files" {
+		return ""
+	}
+	info := filepath.Join(filepath.Dir(filesDir), "info", filepath.Base(trashedPath)+".trashinfo")
+	if !exists(info) {
+		return ""
+	}
+	return info
+}
+
+// collisionName returns the n-th alternative name for base, keeping the
+// extension so trashed files still open with the right application.
+func collisionName(base string, n int) string {
+	ext := filepath.Ext(base)
+	if ext == base || strings.HasPrefix(base, ".") && strings.Count(base, ".") == 1 {
+		ext = ""
+	}
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext)
+}
+
+func callReserved(reserved func(*Item) error, item *Item) error {
+	if reserved == nil {
+		return nil
+	}
+	return reserved(item)
+}
+
+// isPartial reports whether err left a complete copy at the destination.
+func isPartial(err error) bool {
+	var partial *fsutil.PartialMoveError
+	return errors.As(err, &partial)
+}
+
+func moverOrDefault(m *fsutil.Mover) *fsutil.Mover {
+	if m == nil {
+		return fsutil.NewMover()
+	}
+	return m
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,191 @@
+//go:build unix
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+)
+
+// XDG implements the freedesktop.org Trash specification: a home trash under
+// $XDG_DATA_HOME/Trash and per-volume $topdir/.Trash/$uid or $topdir/.Trash-$uid
+// directories for other mounts, each with files/ and info/ subdirectories.
+type XDG struct {
+	HomeTrash string // usually ~/.local/share/Trash
+	UID       int
+	Mover     *fsutil.Mover // nil uses fsutil.NewMover()
+}
+
+func NewXDG(mover *fsutil.Mover) *XDG {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return &XDG{
+		HomeTrash: filepath.Join(dataHome, "Trash"),
+		UID:       os.Getuid(),
+		Mover:     mover,
+	}
+}
+
+func (t *XDG) Put(path string) (*Item, error) {
+	return t.PutWith(path, nil)
+}
+
+func (t *XDG) PutWith(path string, reserved func(*Item) error) (*Item, error) {
+	trashDir, topDir, err := t.trashDirFor(path)
+	if err != nil {
+		return nil, err
+	}
+
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	// Per-volume trashes store paths relative to the volume
+	infoPathValue := path
+	if topDir != "" {
+		if rel, err := filepath.Rel(topDir, path); err == nil {
+			infoPathValue = rel
+		}
+	}
+
+	now := time.Now()
+	name, infoPath, err := reserveInfo(infoDir, filesDir, filepath.Base(path), infoPathValue, now)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(filesDir, name)
+	item := &Item{Path: dest, OriginalPath: path, DeletedAt: now, InfoPath: infoPath}
+	if err := callReserved(reserved, item); err != nil {
+		os.Remove(infoPath)
+		return nil, err
+	}
+	if err := moverOrDefault(t.Mover).Move(path, dest); err != nil {
+		if isPartial(err) {
+			return item, err
+		}
+		os.Remove(infoPath)
+		return nil, err
+	}
+	return item, nil
+}
+
+// reserveInfo atomically creates the .trashinfo file for the first free name,
+// which claims that name in files/ as well. Names already taken in files/,
+// such as items whose info file was lost, are skipped.
+func reserveInfo(infoDir, filesDir, base, originalPath string, deletedAt time.Time) (string, string, error) {
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: originalPath}).EscapedPath(),
+		deletedAt.Format("2006-01-02T15:04:05"))
+
+	name := base
+	for n := 2; ; n, name = n+1, collisionName(base, n) {
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		_, err = f.WriteString(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", "", err
+		}
+		// Claimed the info file; make sure files/ has no orphan by that name
+		if _, err := os.Lstat(filepath.Join(filesDir, name)); err == nil {
+			os.Remove(infoPath)
+			continue
+		}
+		return name, infoPath, nil
+	}
+}
+
+// trashDirFor picks the trash directory for path: the home trash when path is
+// on the same device, otherwise a per-volume trash on path's mount. topDir is
+// empty for the home trash.
+func (t *XDG) trashDirFor(path string) (trashDir, topDir string, err error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	if homeDev, err := deviceOf(existingParent(t.HomeTrash)); err == nil && homeDev == dev {
+		return t.HomeTrash, "", nil
+	}
+
+	topDir = mountPoint(path, dev)
+	uid := strconv.Itoa(t.UID)
+
+	// An admin-created $topdir/.Trash must be a sticky, non-symlink directory
+	shared := filepath.Join(topDir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, uid)
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return dir, topDir, nil
+		}
+	}
+
+	dir := filepath.Join(topDir, ".Trash-"+uid)
+	if err := os.Mkdir(dir, 0700); err == nil || errors.Is(err, os.ErrExist) {
+		if info, err := os.Lstat(dir); err == nil && info.IsDir() {
+			return dir, topDir, nil
+		}
+	}
+
+	// The volume has no usable trash; fall back to the home trash
+	return t.HomeTrash, "", nil
+}
+
+// mountPoint walks up from path until the device changes.
+func mountPoint(path string, dev uint64) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		if d, err := deviceOf(parent); err != nil || d != dev {
+			return path
+		}
+		path = parent
+	}
+}
+
+// existingParent returns path or its closest ancestor that exists.
+func existingParent(path string) string {
+	for !exists(path) {
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	return path
+}
+
+func deviceOf(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Dev), nil
+}
@@ -0,0 +1,190 @@
+//go:build unix
+
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXDG_PutWritesTrashInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	src := filepath.Join(tmpDir, "my report.txt")
+	os.WriteFile(src, []byte("data"), 0644)
+
+	item, err := tr.Put(src)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if item.Path != filepath.Join(tmpDir, "Trash", "files", "my report.txt") {
+		t.Errorf("unexpected trash path %s", item.Path)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source should be gone")
+	}
+
+	info, err := os.ReadFile(filepath.Join(tmpDir, "Trash", "info", "my report.txt.trashinfo"))
+	if err != nil {
+		t.Fatalf("missing trashinfo: %v", err)
+	}
+	content := string(info)
+	if !strings.HasPrefix(content, "[Trash Info]\n") {
+		t.Errorf("trashinfo missing header: %q", content)
+	}
+	if !strings.Contains(content, "Path="+filepath.Join(tmpDir, "my%20report.txt")+"\n") {
+		t.Errorf("trashinfo has wrong path: %q", content)
+	}
+	if !strings.Contains(content, "DeletionDate=") {
+		t.Errorf("trashinfo missing deletion date: %q", content)
+	}
+}
+
+func TestXDG_PutHandlesCollisions(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		src := filepath.Join(tmpDir, "notes.txt")
+		os.WriteFile(src, []byte("data"), 0644)
+		item, err := tr.Put(src)
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		paths = append(paths, filepath.Base(item.Path))
+	}
+
+	expected := []string{"notes.txt", "notes.2.txt", "notes.3.txt"}
+	for i, name := range expected {
+		if paths[i] != name {
+			t.Errorf("expected %s, got %s", name, paths[i])
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "Trash", "info", name+".trashinfo")); err != nil {
+			t.Errorf("missing trashinfo for %s", name)
+		}
+	}
+}
+
+func TestXDG_PutSkipsOrphanedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	// An item left in files/ without its info file
+	os.MkdirAll(filepath.Join(tmpDir, "Trash", "files"), 0700)
+	orphan := filepath.Join(tmpDir, "Trash", "files", "notes.txt")
+	os.WriteFile(orphan, []byte("old"), 0644)
+
+	src := filepath.Join(tmpDir, "notes.txt")
+	os.WriteFile(src, []byte("new"), 0644)
+	item, err := tr.Put(src)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if filepath.Base(item.Path) != "notes.2.txt" {
+		t.Errorf("expected notes.2.txt, got %s", filepath.Base(item.Path))
+	}
+	if data, _ := os.ReadFile(orphan); string(data) != "old" {
+		t.Errorf("orphaned item was overwritten: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "Trash", "info", "notes.txt.trashinfo")); !os.IsNotExist(err) {
+		t.Error("info file reserved for a taken name should be removed")
+	}
+}
+
+func TestXDG_PutWithReservesBeforeMoving(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	src := filepath.Join(tmpDir, "notes.txt")
+	os.WriteFile(src, []byte("data"), 0644)
+
+	var reserved *Item
+	_, err := tr.PutWith(src, func(item *Item) error {
+		reserved = item
+		if _, err := os.Stat(item.InfoPath); err != nil {
+			t.Errorf("info file should exist when reserved is called: %v", err)
+		}
+		if _, err := os.Stat(src); err != nil {
+			t.Error("source should not be moved before reserved is called")
+		}
+		return errors.New("cancelled")
+	})
+	if err == nil || err.Error() != "cancelled" {
+		t.Fatalf("expected the error from reserved, got %v", err)
+	}
+	if reserved == nil || reserved.Path != filepath.Join(tmpDir, "Trash", "files", "notes.txt") {
+		t.Fatalf("unexpected reserved item %+v", reserved)
+	}
+	if _, err := os.Stat(reserved.InfoPath); !os.IsNotExist(err) {
+		t.Error("a cancelled Put should release its info file")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Error("a cancelled Put should leave the source alone")
+	}
+}
+
+func TestRestore_RemovesTrashInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	src := filepath.Join(tmpDir, "dir")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+
+	item, err := tr.Put(src)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if err := Restore(nil, item.Path, src); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "sub")); err != nil {
+		t.Error("directory was not restored")
+	}
+	if _, err := os.Stat(item.InfoPath); !os.IsNotExist(err) {
+		t.Error("trashinfo should be removed after restore")
+	}
+}
+
+func TestCollisionName(t *testing.T) {
+	tests := map[string]string{
+		"file.txt":     "file.2.txt",
+		"archive":      "archive.2",
+		".bashrc":      ".bashrc.2",
+		"node_modules": "node_modules.2",
+	}
+	for base, want := range tests {
+		if got := collisionName(base, 2); got != want {
+			t.Errorf("collisionName(%q) = %q, want %q", base, got, want)
+		}
+	}
+}
+
+func TestPurge_RemovesItemAndTrashInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	tr := &XDG{HomeTrash: filepath.Join(tmpDir, "Trash"), UID: os.Getuid()}
+
+	src := filepath.Join(tmpDir, "old.log")
+	os.WriteFile(src, []byte("data"), 0644)
+
+	item, err := tr.Put(src)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if err := Purge(item.Path); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Stat(item.Path); !os.IsNotExist(err) {
+		t.Error("trashed file should be gone")
+	}
+	if _, err := os.Stat(item.InfoPath); !os.IsNotExist(err) {
+		t.Error("trashinfo should be gone")
+	}
+}
@@ -1,8 +1,11 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -10,6 +13,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/0xjjjjjj/breathe/internal/config"
 	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/openfiles"
 	"github.com/0xjjjjjj/breathe/internal/scanner"
 )
 
@@ -39,12 +43,28 @@ type Model struct {
 	results     chan scanner.ScanResult // Channel for receiving scan results
 	lastPath    string                  // Last file/dir scanned (for progress display)
 	db          *history.DB             // History database for tracking deletions
+	historyErr  error                   // Why db is nil
+	confirm     []string                // Paths awaiting confirmation to delete without history
+	selections  int                     // Deletions started this session
 	statusMsg   string                  // Status message to show user
+	heldDeleted int64                   // Bytes held by deleted files still open under scanPath
+	batchID     string                  // History batch for every deletion in this session
+
+	// Background deletion; deletes is nil when none is running
+	deletes      chan scanner.DeleteResult
+	deletePaths  []string        // Paths being deleted, indexed by DeleteResult.Index
+	deleting     map[string]bool // Paths not finished yet
+	deleteFreed  int64
+	deleteErrs   []string
+	deleteWarned []string
 }
 
 type scanResultMsg scanner.ScanResult
 type scanDoneMsg struct{}
 type pollResultsMsg struct{}
+type deleteResultMsg scanner.DeleteResult
+type deleteDoneMsg struct{}
+type heldDeletedMsg int64
 
 var (
 	titleStyle = lipgloss.NewStyle().
@@ -64,7 +84,7 @@ var (
 			Foreground(lipgloss.Color("241"))
 )
 
-func NewModel(cfg *config.Config, scanPath string) Model {
+func NewModel(cfg *config.Config, scanPath string, view View) Model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
@@ -73,11 +93,13 @@ func NewModel(cfg *config.Config, scanPath string) Model {
 	tree := scanner.NewTree(scanPath)
 	results := make(chan scanner.ScanResult, 1000)
 
-	// Open history database (errors logged but not fatal - TUI can work without history)
+	// Without history the TUI still works, but warns and asks before deleting
+	var status string
 	db, err := history.Open(config.DataPath())
 	if err != nil {
-		// Continue without history - delete will still work, just won't be logged
 		db = nil
+	} else if recovered := db.Recovered(); len(recovered) > 0 {
+		status = recoveredSummary(recovered)
 	}
 
 	// Start scanner in background immediately
@@ -90,25 +112,125 @@ func NewModel(cfg *config.Config, scanPath string) Model {
 		spinner:     s,
 		selected:    make(map[string]bool),
 		matcher:     scanner.NewMatcher(cfg.JunkPatterns),
-		view:        ViewScan,
+		view:        view,
 		tree:        tree,
 		results:     results,
 		scanning:    true,
 		db:          db,
+		historyErr:  err,
+		statusMsg:   status,
+		batchID:     history.NewBatchID(),
 	}
 }
 
-// deleteItem moves an item to trash and removes it from the tree
-func (m *Model) deleteItem(path string) {
+// recoveredSummary describes the interrupted operations that opening history
+// reconciled, which the CLI reports on stderr.
+func recoveredSummary(recovered []history.Recovery) string {
+	completed := 0
+	for _, r := range recovered {
+		if r.Completed {
+			completed++
+		}
+	}
+	return fmt.Sprintf("Recovered %d interrupted operations: %d completed, %d failed (see breathe history)",
+		len(recovered), completed, len(recovered)-completed)
+}
+
+// startDelete moves paths to the trash on a worker pool and returns the
+// command that streams their results back, so the UI stays responsive. Each
+// call is one selection of the session's batch in history.
+func (m *Model) startDelete(paths []string) tea.Cmd {
+	paths = outermost(paths)
+
 	cleaner := scanner.NewCleaner(m.db, true) // true = use trash
-	if err := cleaner.Delete(path); err != nil {
-		m.statusMsg = fmt.Sprintf("Error: %v", err)
-		return
+	cleaner.SetGuard(scanner.NewGuard(m.cfg.Safety))
+	cleaner.SetGitCheck(m.cfg.Safety.GitCheck)
+	cleaner.SetRequireHistory(m.cfg.History.Required)
+	cleaner.SetBatch(m.batchID)
+	m.selections++
+	root, matcher, selection := m.scanPath, m.matcher, strconv.Itoa(m.selections)
+	cleaner.SetMetadata(func(path string) map[string]string {
+		metadata := map[string]string{"origin": "tui", "scan_root": root, "selection": selection}
+		if matches := matcher.Match(path); len(matches) > 0 {
+			metadata["junk_group"] = matches[0].Name
+		}
+		return metadata
+	})
+	if !m.scanning {
+		cleaner.SetSizes(m.tree) // Sizes are final once the scan is done
 	}
 
-	// Remove from tree
+	m.deletes = make(chan scanner.DeleteResult, len(paths))
+	m.deletePaths = paths
+	m.deleting = make(map[string]bool, len(paths))
+	for _, p := range paths {
+		m.deleting[p] = true
+	}
+	m.deleteFreed = 0
+	m.deleteErrs = nil
+	m.deleteWarned = nil
+
+	go cleaner.DeleteAll(paths, scanner.DeleteWorkers, m.deletes)
+	return pollDeletes(m.deletes)
+}
+
+// finishDelete applies one deletion result to the tree.
+func (m *Model) finishDelete(r scanner.DeleteResult) {
+	path := m.deletePaths[r.Index]
+	delete(m.deleting, path)
+
+	if r.Err != nil && !errors.Is(r.Err, history.ErrNotRecorded) {
+		m.deleteErrs = append(m.deleteErrs, fmt.Sprintf("%s: %v", filepath.Base(path), r.Err))
+		return
+	}
 	m.tree.Remove(path)
-	m.statusMsg = fmt.Sprintf("Trashed: %s", filepath.Base(path))
+	m.deleteFreed += r.Decision.Size
+	m.deleteWarned = append(m.deleteWarned, r.Decision.Warnings...)
+	if r.Err != nil {
+		m.deleteWarned = append(m.deleteWarned, r.Err.Error())
+	}
+
+	// Reset cursor if it's now out of bounds
+	children := m.tree.Children(m.currentPath)
+	if m.cursor >= len(children) && m.cursor > 0 {
+		m.cursor = len(children) - 1
+	}
+}
+
+// deleteSummary describes a finished background deletion.
+func (m Model) deleteSummary() string {
+	done := len(m.deletePaths) - len(m.deleteErrs)
+	msg := fmt.Sprintf("Trashed %d items (%s)", done, formatSize(m.deleteFreed))
+	if len(m.deletePaths) == 1 && done == 1 {
+		msg = fmt.Sprintf("Trashed: %s", filepath.Base(m.deletePaths[0]))
+	}
+	if len(m.deleteErrs) > 0 {
+		msg += fmt.Sprintf("; %d failed: %s", len(m.deleteErrs), m.deleteErrs[0])
+		if len(m.deletePaths) == 1 {
+			msg = "Error: " + m.deleteErrs[0]
+		}
+	}
+	if len(m.deleteWarned) > 0 {
+		msg += fmt.Sprintf(" (warning: %s)", strings.Join(m.deleteWarned, "; "))
+	}
+	return msg
+}
+
+// outermost drops paths inside other paths in the list, since deleting the
+// outer path takes them along.
+func outermost(paths []string) []string {
+	sort.Strings(paths)
+	var kept []string
+	for _, p := range paths {
+		if len(kept) > 0 {
+			last := kept[len(kept)-1]
+			if p == last || strings.HasPrefix(p, last+string(filepath.Separator)) {
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
 }
 
 func (m Model) Init() tea.Cmd {
@@ -116,6 +238,17 @@ func (m Model) Init() tea.Cmd {
 	return tea.Batch(m.spinner.Tick, pollResults(m.results))
 }
 
+// pollDeletes creates a command that reads the next deletion result
+func pollDeletes(results chan scanner.DeleteResult) tea.Cmd {
+	return func() tea.Msg {
+		r, ok := <-results
+		if !ok {
+			return deleteDoneMsg{}
+		}
+		return deleteResultMsg(r)
+	}
+}
+
 // pollResults creates a command that reads from the results channel
 func pollResults(results chan scanner.ScanResult) tea.Cmd {
 	return func() tea.Msg {
@@ -127,6 +260,20 @@ func pollResults(results chan scanner.ScanResult) tea.Cmd {
 	}
 }
 
+// checkHeldDeleted creates a command that totals the deleted files under root
+// that running processes still hold open
+func checkHeldDeleted(root string) tea.Cmd {
+	return func() tea.Msg {
+		var size int64
+		if files, err := openfiles.Deleted(root); err == nil {
+			for _, f := range files {
+				size += f.Size
+			}
+		}
+		return heldDeletedMsg(size)
+	}
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -134,6 +281,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		maxItems := m.visibleItems()
 		m.statusMsg = "" // Clear status on any keypress
 
+		if m.confirm != nil {
+			paths := m.confirm
+			m.confirm = nil
+			if msg.String() == "y" {
+				return m, m.startDelete(paths)
+			}
+			m.statusMsg = "Delete cancelled"
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
@@ -184,20 +341,33 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 		case "d":
+			if m.deletes != nil {
+				m.statusMsg = "Wait for the current deletion to finish"
+				break
+			}
 			// Delete selected items (or current item if none selected)
+			var paths []string
 			if len(m.selected) > 0 {
 				for path := range m.selected {
-					m.deleteItem(path)
+					paths = append(paths, path)
 				}
 				m.selected = make(map[string]bool)
 			} else if m.cursor < len(children) {
-				m.deleteItem(children[m.cursor].Path)
+				paths = append(paths, children[m.cursor].Path)
+			}
+			if len(paths) == 0 {
+				break
 			}
-			// Reset cursor if it's now out of bounds
-			newChildren := m.tree.Children(m.currentPath)
-			if m.cursor >= len(newChildren) && m.cursor > 0 {
-				m.cursor = len(newChildren) - 1
+			if m.db == nil {
+				if m.cfg.History.Required {
+					m.statusMsg = "Not deleting: history is unavailable and history.required is set"
+					break
+				}
+				m.confirm = paths
+				m.statusMsg = fmt.Sprintf("Delete %d items without recording history? They can't be undone with breathe. [y] Yes  [any key] Cancel", len(paths))
+				break
 			}
+			return m, m.startDelete(paths)
 		}
 
 	case tea.WindowSizeMsg:
@@ -219,8 +389,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Continue polling for more results
 		return m, pollResults(m.results)
 
+	case deleteResultMsg:
+		m.finishDelete(scanner.DeleteResult(msg))
+		return m, pollDeletes(m.deletes)
+
+	case deleteDoneMsg:
+		m.statusMsg = m.deleteSummary()
+		m.deletes = nil
+		return m, nil
+
 	case scanDoneMsg:
 		m.scanning = false
+		return m, checkHeldDeleted(m.scanPath)
+
+	case heldDeletedMsg:
+		m.heldDeleted = int64(msg)
 		return m, nil
 	}
 
@@ -234,13 +417,21 @@ func (m Model) visibleItems() int {
 	if m.scanning {
 		available-- // Extra line for "scanning" path
 	}
+	if m.heldDeleted > 0 {
+		available-- // Warning about deleted files still open
+	}
+	if m.historyErr != nil {
+		available-- // Warning that history is unavailable
+	}
+	if m.deletes != nil {
+		available-- // Deletion progress
+	}
 	if available < 5 {
 		available = 5
 	}
 	return available
 }
 
-
 func (m Model) View() string {
 	if m.tree == nil {
 		return "Initializing..."
@@ -271,7 +462,14 @@ func (m Model) View() string {
 			m.scanPath)
 	}
 
-	s += titleStyle.Render(fmt.Sprintf("Total: %s", formatSize(m.tree.Root().Size))) + "\n\n"
+	s += titleStyle.Render(fmt.Sprintf("Total: %s", formatSize(m.tree.Root().Size))) + "\n"
+	if m.historyErr != nil {
+		s += junkStyle.Render(fmt.Sprintf("⚠ History unavailable, deletions can't be undone: %v", m.historyErr)) + "\n"
+	}
+	if m.heldDeleted > 0 {
+		s += junkStyle.Render(fmt.Sprintf("⚠ %s held by deleted files still open (breathe scan --open-deleted)", formatSize(m.heldDeleted))) + "\n"
+	}
+	s += "\n"
 
 	// Tree view
 	if m.view == ViewScan {
@@ -284,6 +482,14 @@ func (m Model) View() string {
 	if m.statusMsg != "" {
 		s += "\n" + junkStyle.Render(m.statusMsg)
 	}
+	if m.deletes != nil {
+		done := len(m.deletePaths) - len(m.deleting)
+		s += "\n" + fmt.Sprintf("%s Deleting %d/%d (%s trashed", m.spinner.View(), done, len(m.deletePaths), formatSize(m.deleteFreed))
+		if len(m.deleteErrs) > 0 {
+			s += fmt.Sprintf(", %d failed", len(m.deleteErrs))
+		}
+		s += ")"
+	}
 
 	// Footer
 	s += "\n" + helpStyle.Render("[↑↓] Navigate  [Enter] Open dir  [h] Back  [Space] Select  [d] Delete  [Tab] Junk  [q] Quit")
@@ -324,6 +530,8 @@ func (m Model) renderTree() string {
 		selectMark := " "
 		if m.selected[child.Path] {
 			selectMark = "●"
+		} else if m.deleting[child.Path] {
+			selectMark = "…"
 		}
 
 		icon := "📄"
@@ -391,8 +599,8 @@ func formatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-func Run(cfg *config.Config, path string) error {
-	p := tea.NewProgram(NewModel(cfg, path), tea.WithAltScreen())
+func Run(cfg *config.Config, path string, view View) error {
+	p := tea.NewProgram(NewModel(cfg, path, view), tea.WithAltScreen())
 	_, err := p.Run()
 	return err
 }
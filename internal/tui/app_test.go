@@ -0,0 +1,145 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/0xjjjjjj/breathe/internal/config"
+	"github.com/0xjjjjjj/breathe/internal/history"
+)
+
+// testHome points the history database and the trash at a new directory.
+func testHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	return home
+}
+
+// scannedModel returns a model for root with the scan finished.
+func scannedModel(t *testing.T, cfg *config.Config, root string) Model {
+	t.Helper()
+	m := NewModel(cfg, root, ViewScan)
+	t.Cleanup(func() {
+		if m.db != nil {
+			m.db.Close()
+		}
+	})
+	for m.scanning {
+		m = update(t, m, pollResults(m.results)())
+	}
+	return m
+}
+
+func update(t *testing.T, m Model, msg tea.Msg) Model {
+	t.Helper()
+	next, _ := m.Update(msg)
+	return next.(Model)
+}
+
+func key(k string) tea.KeyMsg {
+	if k == " " {
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(k)}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+func TestNewModel_ReportsRecoveredOperations(t *testing.T) {
+	home := testHome(t)
+
+	db, err := history.Open(config.DataPath())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	// A pid far above any kernel's limit belongs to no process
+	db.Record(history.Operation{Type: history.OpDelete, SourcePath: filepath.Join(home, "gone"),
+		State: history.StatePending, Metadata: map[string]string{"pid": strconv.Itoa(1 << 30)}})
+	db.Close()
+
+	m := scannedModel(t, config.DefaultConfig(), t.TempDir())
+	if !strings.Contains(m.statusMsg, "Recovered 1 interrupted operations: 1 completed") {
+		t.Errorf("expected the recovery in the status, got %q", m.statusMsg)
+	}
+	if !strings.Contains(m.View(), "Recovered 1") {
+		t.Error("expected the recovery shown in the view")
+	}
+}
+
+func TestModel_ConfirmsDeleteWithoutHistory(t *testing.T) {
+	home := testHome(t)
+	// A file where the history directory should be makes history unavailable
+	os.MkdirAll(filepath.Join(home, ".local", "share"), 0755)
+	os.WriteFile(filepath.Dir(config.DataPath()), nil, 0644)
+
+	root := t.TempDir()
+	file := filepath.Join(root, "big.log")
+	os.WriteFile(file, []byte("data"), 0644)
+
+	m := scannedModel(t, config.DefaultConfig(), root)
+	if m.historyErr == nil {
+		t.Fatal("expected history to be unavailable")
+	}
+	if !strings.Contains(m.View(), "History unavailable") {
+		t.Error("expected a banner saying history is unavailable")
+	}
+
+	// Any key but y cancels
+	m = update(t, m, key("d"))
+	if m.confirm == nil || !strings.Contains(m.statusMsg, "without recording history") {
+		t.Fatalf("expected a confirmation prompt, got %q", m.statusMsg)
+	}
+	m = update(t, m, key("n"))
+	if m.confirm != nil || m.statusMsg != "Delete cancelled" {
+		t.Errorf("expected the delete cancelled, got %q", m.statusMsg)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal("a cancelled delete removed the file")
+	}
+
+	// y deletes
+	m = update(t, m, key("d"))
+	next, cmd := m.Update(key("y"))
+	m = next.(Model)
+	if cmd == nil {
+		t.Fatal("expected the delete to start")
+	}
+	for msg := cmd(); ; msg = pollDeletes(m.deletes)() {
+		m = update(t, m, msg)
+		if _, done := msg.(deleteDoneMsg); done {
+			break
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("confirmed delete should move the file to the trash")
+	}
+	if !strings.HasPrefix(m.statusMsg, "Trashed") {
+		t.Errorf("unexpected status %q", m.statusMsg)
+	}
+}
+
+func TestModel_RefusesDeleteWhenHistoryRequired(t *testing.T) {
+	home := testHome(t)
+	os.MkdirAll(filepath.Join(home, ".local", "share"), 0755)
+	os.WriteFile(filepath.Dir(config.DataPath()), nil, 0644)
+
+	root := t.TempDir()
+	file := filepath.Join(root, "big.log")
+	os.WriteFile(file, []byte("data"), 0644)
+
+	cfg := config.DefaultConfig()
+	cfg.History.Required = true
+	m := scannedModel(t, cfg, root)
+
+	m = update(t, m, key("d"))
+	if m.confirm != nil || !strings.Contains(m.statusMsg, "history.required") {
+		t.Errorf("expected the delete refused, got %q", m.statusMsg)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Error("refused delete removed the file")
+	}
+}
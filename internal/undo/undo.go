@@ -0,0 +1,372 @@
+// Package undo reverts and reapplies history operations safely: it checks that
+// the item is unchanged and still where the operation left it, resolves
+// conflicts at the target location, and records each undo and redo so the
+// chain can be followed and nothing is reverted twice.
+package undo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+// Strategy says what to do when something already exists at the path an
+// operation is undone to.
+type Strategy string
+
+const (
+	Fail      Strategy = ""          // Refuse to undo
+	Rename    Strategy = "rename"    // Restore next to it under a new name
+	Skip      Strategy = "skip"      // Leave the operation as it is
+	Overwrite Strategy = "overwrite" // Move the existing item to the trash first
+)
+
+var (
+	ErrAlreadyUndone = errors.New("operation was already undone")
+	ErrAlreadyRedone = errors.New("operation was already redone")
+	ErrNotUndone     = errors.New("operation is not undone")
+	ErrNotReversible = errors.New("operation is not reversible")
+	ErrMissing       = errors.New("item is no longer where the operation left it")
+	ErrModified      = errors.New("item changed since the operation")
+	ErrConflict      = errors.New("target path is taken")
+	ErrSkipped       = errors.New("skipped")
+)
+
+// Result describes a completed undo or redo.
+type Result struct {
+	Path      string // Where the item is now; differs from the usual target after Rename
+	Displaced string // Where Overwrite trashed the item that was in the way
+	ID        int64  // History ID of the undo or redo operation
+}
+
+type Undoer struct {
+	OnConflict Strategy
+	Force      bool              // Proceed even if the item changed since the operation
+	BatchID    string            // Recorded on undo and redo operations
+	Quarantine *trash.Quarantine // Needed to redo quarantine operations
+
+	db    *history.DB
+	mover *fsutil.Mover
+	trash trash.Trash
+}
+
+func New(db *history.DB, mover *fsutil.Mover) *Undoer {
+	if mover == nil {
+		mover = fsutil.NewMover()
+	}
+	return &Undoer{db: db, mover: mover, trash: trash.Default(mover)}
+}
+
+// Undo reverts op and records an OpUndo for it.
+func (u *Undoer) Undo(op *history.Operation) (*Result, error) {
+	if op.State == history.StateUndone {
+		return nil, u.undoneError(op.ID)
+	}
+	if !op.Reversible {
+		return nil, ErrNotReversible
+	}
+	switch op.Type {
+	case history.OpMove, history.OpTrash, history.OpQuarantine:
+	case history.OpUndo:
+		return nil, fmt.Errorf("operation %d is an undo; redo it instead", op.ID)
+	default:
+		return nil, fmt.Errorf("cannot undo operation type: %s", op.Type)
+	}
+
+	if err := u.verify(op.DestPath, op.FileHash); err != nil {
+		return nil, err
+	}
+
+	res, err := u.claim(op.SourcePath, ".restored")
+	if err != nil {
+		return nil, err
+	}
+
+	record := history.Operation{
+		Type:       history.OpUndo,
+		SourcePath: op.DestPath,
+		DestPath:   res.Path,
+		FileSize:   op.FileSize,
+		FileHash:   op.FileHash,
+		InverseOf:  op.ID,
+		BatchID:    u.BatchID,
+	}
+	if res.ID, err = u.db.Begin(record); err != nil {
+		return nil, err
+	}
+
+	switch op.Type {
+	case history.OpMove:
+		err = u.mover.Move(op.DestPath, res.Path)
+	case history.OpTrash:
+		err = trash.Restore(u.mover, op.DestPath, res.Path)
+	case history.OpQuarantine:
+		err = trash.Unquarantine(u.mover, op.DestPath, res.Path)
+	}
+	if err != nil && !isPartial(err) {
+		return nil, u.fail(res.ID, err)
+	}
+
+	// After a partial move the item is back in place, so the undo is
+	// recorded and the error about its leftovers returned
+	record.Metadata = res.metadata(op.SourcePath)
+	if cerr := u.db.Complete(res.ID, record); cerr != nil {
+		return res, cerr
+	}
+	return res, err
+}
+
+// Redo applies an undone operation again. op is either the undone operation
+// or the undo that reverted it. The redo is recorded with the original type,
+// so it can be undone in turn.
+func (u *Undoer) Redo(op *history.Operation) (*Result, error) {
+	undo, target, err := u.undoOf(op)
+	if err != nil {
+		return nil, err
+	}
+
+	// The undo may have restored the item under a new name
+	from := undo.DestPath
+	if err := u.verify(from, target.FileHash); err != nil {
+		return nil, err
+	}
+
+	switch target.Type {
+	case history.OpMove, history.OpTrash:
+	case history.OpQuarantine:
+		if u.Quarantine == nil {
+			return nil, fmt.Errorf("no quarantine configured")
+		}
+	default:
+		return nil, fmt.Errorf("cannot redo operation type: %s", target.Type)
+	}
+
+	res := &Result{}
+	if target.Type == history.OpMove {
+		if res, err = u.claim(target.DestPath, ".redone"); err != nil {
+			return nil, err
+		}
+	}
+
+	record := history.Operation{
+		Type:       target.Type,
+		SourcePath: from,
+		DestPath:   res.Path,
+		FileSize:   target.FileSize,
+		FileHash:   target.FileHash,
+		InverseOf:  undo.ID,
+		BatchID:    u.BatchID,
+		Metadata:   make(map[string]string),
+	}
+	// Trashed and quarantined items get their place first, so the intent
+	// records where they go
+	begin := func() (err error) {
+		record.DestPath = res.Path
+		res.ID, err = u.db.Begin(record)
+		return err
+	}
+
+	switch target.Type {
+	case history.OpMove:
+		record.Metadata = res.metadata(target.DestPath)
+		if err = begin(); err == nil {
+			err = u.mover.Move(from, res.Path)
+		}
+	case history.OpTrash:
+		_, err = u.trash.PutWith(from, func(item *trash.Item) error {
+			res.Path = item.Path
+			return begin()
+		})
+	case history.OpQuarantine:
+		_, err = u.Quarantine.PutWith(from, func(item *trash.Item) error {
+			res.Path = item.Path
+			record.Metadata["expires_at"] = item.ExpiresAt.Format(time.RFC3339)
+			return begin()
+		})
+	}
+	if res.ID == 0 {
+		return nil, err // Nothing was recorded or moved
+	}
+	if err != nil && !isPartial(err) {
+		return nil, u.fail(res.ID, err)
+	}
+
+	record.Reversible = true
+	if cerr := u.db.Complete(res.ID, record); cerr != nil {
+		return res, cerr
+	}
+	return res, err
+}
+
+// undoOf returns the undo currently in effect for op and the operation it
+// reverted.
+func (u *Undoer) undoOf(op *history.Operation) (undo, target *history.Operation, err error) {
+	target = op
+	if op.Type == history.OpUndo {
+		if target, err = u.db.Get(op.InverseOf); err != nil {
+			return nil, nil, fmt.Errorf("operation %d reverted by this undo not found", op.InverseOf)
+		}
+	}
+
+	switch target.State {
+	case history.StateUndone:
+	case history.StateRedone:
+		return nil, nil, ErrAlreadyRedone
+	default:
+		return nil, nil, ErrNotUndone
+	}
+
+	inverses, err := u.db.Inverses(target.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(inverses) - 1; i >= 0; i-- {
+		inv := inverses[i]
+		if inv.Type == history.OpUndo && inv.State == history.StateApplied {
+			return &inv, target, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: no undo of operation %d in effect", ErrNotUndone, target.ID)
+}
+
+// undoneError names the undo that reverted the operation with the given ID.
+func (u *Undoer) undoneError(id int64) error {
+	inverses, _ := u.db.Inverses(id)
+	for i := len(inverses) - 1; i >= 0; i-- {
+		if inverses[i].Type == history.OpUndo && inverses[i].State != history.StateFailed {
+			return fmt.Errorf("%w by operation %d", ErrAlreadyUndone, inverses[i].ID)
+		}
+	}
+	return ErrAlreadyUndone
+}
+
+// claim resolves a conflict at path according to OnConflict and creates its
+// parent directory. Renamed paths get suffix before the extension.
+func (u *Undoer) claim(path, suffix string) (*Result, error) {
+	res := &Result{Path: path}
+	if _, err := os.Lstat(path); err == nil {
+		switch u.OnConflict {
+		case Skip:
+			return nil, fmt.Errorf("%w: %s exists", ErrSkipped, path)
+		case Rename:
+			res.Path = freeName(path, suffix)
+		case Overwrite:
+			displaced, err := u.displace(path)
+			if err != nil {
+				return nil, err
+			}
+			res.Displaced = displaced
+		default:
+			return nil, fmt.Errorf("%w: %s exists (use --rename, --skip or --overwrite)", ErrConflict, path)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(res.Path), 0755); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// metadata describes how claiming target was resolved.
+func (r *Result) metadata(target string) map[string]string {
+	metadata := make(map[string]string)
+	if r.Path != target {
+		metadata["renamed_from"] = target
+	}
+	if r.Displaced != "" {
+		metadata["displaced_to"] = r.Displaced
+	}
+	return metadata
+}
+
+// fail marks the pending undo or redo id failed and returns the failure of
+// its filesystem step.
+func (u *Undoer) fail(id int64, err error) error {
+	if recErr := u.db.Fail(id, err); recErr != nil {
+		return fmt.Errorf("%w (and recording the failure: %v)", err, recErr)
+	}
+	return err
+}
+
+// verify checks that the item at path exists and, for files with a recorded
+// hash, that its contents are unchanged.
+func (u *Undoer) verify(path, hash string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMissing, path)
+	}
+	if hash == "" || !info.Mode().IsRegular() || u.Force {
+		return nil
+	}
+
+	current, err := fsutil.HashFile(path)
+	if err != nil {
+		return err
+	}
+	if current != hash {
+		return fmt.Errorf("%w: %s (use --force to proceed anyway)", ErrModified, path)
+	}
+	return nil
+}
+
+// displace moves the item at path to the trash and records it, so
+// overwriting during undo can itself be undone.
+func (u *Undoer) displace(path string) (string, error) {
+	op := history.Operation{
+		Type:       history.OpTrash,
+		SourcePath: path,
+		Metadata:   map[string]string{"reason": "displaced by undo"},
+		BatchID:    u.BatchID,
+	}
+	var id int64
+	item, err := u.trash.PutWith(path, func(item *trash.Item) (err error) {
+		op.DestPath = item.Path
+		id, err = u.db.Begin(op)
+		return err
+	})
+	if id == 0 {
+		return "", err
+	}
+	if err != nil && !isPartial(err) {
+		return "", u.fail(id, err)
+	}
+	op.Reversible = true
+	if cerr := u.db.Complete(id, op); cerr != nil {
+		return "", cerr
+	}
+	return item.Path, err
+}
+
+// isPartial reports whether err comes from a move that left a complete copy
+// at its destination but could not remove the source.
+func isPartial(err error) bool {
+	var partial *fsutil.PartialMoveError
+	return errors.As(err, &partial)
+}
+
+// freeName returns the first unused "name<suffix>.ext" style path next to
+// path, numbering the suffix if needed.
+func freeName(path, suffix string) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	candidate := filepath.Join(dir, stem+suffix+ext)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = filepath.Join(dir, stem+suffix+"-"+strconv.Itoa(n)+ext)
+	}
+}
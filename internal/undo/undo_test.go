@@ -0,0 +1,171 @@
+package undo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xjjjjjj/breathe/internal/fsutil"
+	"github.com/0xjjjjjj/breathe/internal/history"
+	"github.com/0xjjjjjj/breathe/internal/trash"
+)
+
+// movedFile sets up a file that was moved from src to dst and recorded.
+func movedFile(t *testing.T) (*Undoer, *history.DB, *history.Operation, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	db, err := history.Open(filepath.Join(tmpDir, "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	src := filepath.Join(tmpDir, "Downloads", "report.pdf")
+	dst := filepath.Join(tmpDir, "Documents", "report.pdf")
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	os.WriteFile(dst, []byte("report"), 0644)
+	hash, _ := fsutil.HashFile(dst)
+
+	id, _ := db.Record(history.Operation{
+		Type: history.OpMove, SourcePath: src, DestPath: dst, FileHash: hash, Reversible: true,
+	})
+	op, _ := db.Get(id)
+
+	u := New(db, nil)
+	u.trash = &trash.HomeTrash{Dir: filepath.Join(tmpDir, "Trash")}
+	return u, db, op, tmpDir
+}
+
+func TestUndo_RestoresAndRecreatesParent(t *testing.T) {
+	u, db, op, _ := movedFile(t)
+
+	res, err := u.Undo(op)
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if data, err := os.ReadFile(op.SourcePath); err != nil || string(data) != "report" {
+		t.Errorf("file not restored: %v", err)
+	}
+
+	undo, err := db.Get(res.ID)
+	if err != nil || undo.Type != history.OpUndo || undo.InverseOf != op.ID {
+		t.Errorf("expected an undo record, got %+v (%v)", undo, err)
+	}
+
+	// The original can't be undone twice
+	again, _ := db.Get(op.ID)
+	if _, err := u.Undo(again); !errors.Is(err, ErrAlreadyUndone) {
+		t.Errorf("expected ErrAlreadyUndone, got %v", err)
+	}
+}
+
+func TestUndo_RefusesModifiedFile(t *testing.T) {
+	u, _, op, _ := movedFile(t)
+	os.WriteFile(op.DestPath, []byte("edited"), 0644)
+
+	if _, err := u.Undo(op); !errors.Is(err, ErrModified) {
+		t.Fatalf("expected ErrModified, got %v", err)
+	}
+
+	u.Force = true
+	if _, err := u.Undo(op); err != nil {
+		t.Errorf("Undo() with Force error = %v", err)
+	}
+}
+
+func TestUndo_Conflicts(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		wantErr  error
+		check    func(t *testing.T, op *history.Operation, res *Result)
+	}{
+		{strategy: Fail, wantErr: ErrConflict},
+		{strategy: Skip, wantErr: ErrSkipped},
+		{strategy: Rename, check: func(t *testing.T, op *history.Operation, res *Result) {
+			want := filepath.Join(filepath.Dir(op.SourcePath), "report.restored.pdf")
+			if res.Path != want {
+				t.Errorf("expected restore to %s, got %s", want, res.Path)
+			}
+			if data, _ := os.ReadFile(op.SourcePath); string(data) != "newer" {
+				t.Error("existing file should be kept")
+			}
+		}},
+		{strategy: Overwrite, check: func(t *testing.T, op *history.Operation, res *Result) {
+			if data, _ := os.ReadFile(op.SourcePath); string(data) != "report" {
+				t.Error("restored file should replace the existing one")
+			}
+			if data, _ := os.ReadFile(res.Displaced); string(data) != "newer" {
+				t.Error("existing file should be in the trash")
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			u, _, op, _ := movedFile(t)
+			os.MkdirAll(filepath.Dir(op.SourcePath), 0755)
+			os.WriteFile(op.SourcePath, []byte("newer"), 0644)
+
+			u.OnConflict = tt.strategy
+			res, err := u.Undo(op)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				if _, err := os.Stat(op.DestPath); err != nil {
+					t.Error("moved file should stay in place")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+			tt.check(t, op, res)
+		})
+	}
+}
+
+func TestRedo_AppliesAgainAndCanBeUndone(t *testing.T) {
+	u, db, op, _ := movedFile(t)
+
+	undoRes, err := u.Undo(op)
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	undo, _ := db.Get(undoRes.ID)
+
+	// Redo accepts the undo as well as the undone operation
+	res, err := u.Redo(undo)
+	if err != nil {
+		t.Fatalf("Redo() error = %v", err)
+	}
+	if _, err := os.Stat(op.DestPath); err != nil {
+		t.Errorf("file not moved again: %v", err)
+	}
+
+	op, _ = db.Get(op.ID)
+	if _, err := u.Redo(op); !errors.Is(err, ErrAlreadyRedone) {
+		t.Errorf("expected ErrAlreadyRedone, got %v", err)
+	}
+
+	redo, _ := db.Get(res.ID)
+	if redo.Type != history.OpMove || redo.InverseOf != undo.ID {
+		t.Errorf("unexpected redo record %+v", redo)
+	}
+	if _, err := u.Undo(redo); err != nil {
+		t.Errorf("Undo() of redo error = %v", err)
+	}
+	if _, err := os.Stat(op.SourcePath); err != nil {
+		t.Errorf("file not restored again: %v", err)
+	}
+}
+
+func TestRedo_RequiresUndone(t *testing.T) {
+	u, _, op, _ := movedFile(t)
+
+	if _, err := u.Redo(op); !errors.Is(err, ErrNotUndone) {
+		t.Errorf("expected ErrNotUndone, got %v", err)
+	}
+}